@@ -0,0 +1,176 @@
+/*
+ * (C) Copyright 2024 Johan Michel PIQUET, France (https://johanpiquet.fr/).
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpServer
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// AcmeChallengeTlsAlpn is the challenge where the ACME server
+// checks the domain with a TLS connection on port 443. It's the default.
+const AcmeChallengeTlsAlpn = "tls-alpn-01"
+
+// AcmeChallengeHttp is the challenge where the ACME server checks the domain by
+// requesting a file under AcmeChallengePath with a plain http connection on port 80.
+const AcmeChallengeHttp = "http-01"
+
+// AcmeChallengePath is the path where the ACME server requests the http-01 tokens.
+const AcmeChallengePath = "/.well-known/acme-challenge/"
+
+// newAcmeManager creates the ACME client of a host from his params.
+// Without directory url, Let's Encrypt production directory is used.
+func newAcmeManager(params HttpsCertificateParams) (*autocert.Manager, error) {
+	challengeType := params.AcmeChallengeType
+
+	if (challengeType != "") && (challengeType != AcmeChallengeTlsAlpn) && (challengeType != AcmeChallengeHttp) {
+		return nil, errors.New("unknown ACME challenge type " + challengeType)
+	}
+
+	certCacheDir := toAbsolutePath(params.CertCacheDir)
+	_ = os.MkdirAll(certCacheDir, os.ModePerm)
+
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(params.Hostname),
+		Cache:      autocert.DirCache(certCacheDir),
+		Email:      params.AcmeEmail,
+	}
+
+	if (params.AcmeDirectoryUrl != "") || (params.AcmeDirectoryCaFile != "") {
+		client := &acme.Client{DirectoryURL: params.AcmeDirectoryUrl}
+
+		if client.DirectoryURL == "" {
+			client.DirectoryURL = autocert.DefaultACMEDirectory
+		}
+
+		// Allows using an internal CA whose certificate isn't trusted by the system.
+		if params.AcmeDirectoryCaFile != "" {
+			httpClient, err := newHttpClientTrusting(params.AcmeDirectoryCaFile)
+			if err != nil {
+				return nil, err
+			}
+
+			client.HTTPClient = httpClient
+		}
+
+		manager.Client = client
+	}
+
+	if params.AcmeEabKeyId != "" {
+		hmacKey, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(params.AcmeEabHmacKey, "="))
+		if err != nil {
+			return nil, errors.New("the EAB hmac key must be encoded with base64url")
+		}
+
+		manager.ExternalAccountBinding = &acme.ExternalAccountBinding{
+			KID: params.AcmeEabKeyId,
+			Key: hmacKey,
+		}
+	}
+
+	return manager, nil
+}
+
+// newHttpClientTrusting returns an http client trusting the CA certificates of the PEM file.
+func newHttpClientTrusting(caFilePath string) (*http.Client, error) {
+	caPem, err := os.ReadFile(toAbsolutePath(caFilePath))
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+
+	if !pool.AppendCertsFromPEM(caPem) {
+		return nil, errors.New("no certificate found in " + caFilePath)
+	}
+
+	return &http.Client{
+		Timeout: time.Minute,
+
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		},
+	}, nil
+}
+
+// buildAcmeHttpChallengeMiddleware returns the middleware answering to the
+// http-01 challenge, which must be bound to AcmeChallengePath + "*".
+func buildAcmeHttpChallengeMiddleware(manager *autocert.Manager) HttpMiddleware {
+	// Calling HTTPHandler is what enables the http-01 challenge.
+	handler := manager.HTTPHandler(nil)
+
+	return func(call HttpRequest) error {
+		// The ACME server can use a port which isn't 80 (when testing)
+		// but the hostname must match the host policy.
+		host := string(call.URI().UriHost())
+
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+
+		req := &http.Request{
+			Method: call.GetMethodName(),
+			Host:   host,
+			URL:    &url.URL{Path: call.Path()},
+			Header: make(http.Header),
+		}
+
+		writer := &acmeResponseWriter{header: make(http.Header), status: http.StatusOK}
+		handler.ServeHTTP(writer, req)
+
+		contentType := writer.header.Get("Content-Type")
+		if contentType != "" {
+			call.SetContentType(contentType)
+		}
+
+		call.ReturnString(writer.status, writer.body.String())
+
+		return nil
+	}
+}
+
+// acmeResponseWriter allows calling the http.Handler of autocert without depending on net/http server.
+type acmeResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (m *acmeResponseWriter) Header() http.Header {
+	return m.header
+}
+
+func (m *acmeResponseWriter) Write(data []byte) (int, error) {
+	return m.body.Write(data)
+}
+
+func (m *acmeResponseWriter) WriteHeader(statusCode int) {
+	m.status = statusCode
+}
@@ -0,0 +1,557 @@
+/*
+ * (C) Copyright 2024 Johan Michel PIQUET, France (https://johanpiquet.fr/).
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpServer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CertificateStore selects the certificate to use from the hostname sent by the
+// browser (SNI). It supports wildcard certificates like "*.example.com", mixing certificate
+// files and Let's Encrypt, and reloads the certificate files once they are renewed.
+type CertificateStore struct {
+	byHostname   map[string]*certificateStoreEntry
+	defaultEntry *certificateStoreEntry
+	mutex        sync.RWMutex
+
+	useTlsAlpn bool
+
+	// clientAuth is the default client certificate verification,
+	// used by the hosts which don't have their own.
+	clientAuth *certificateClientAuth
+
+	devCertificateAuthority *DevCertificateAuthority
+
+	watchStop   chan struct{}
+	watchMutex  sync.Mutex
+	reloadMutex sync.Mutex
+
+	// getLogger returns the logger where the reload errors of StartWatching are written.
+	// It's the logger of the server, or the standard logger if nil.
+	getLogger func() *log.Logger
+}
+
+// CertificateInfo describes a certificate of the store.
+// Allows alerting when a certificate is about to expire.
+type CertificateInfo struct {
+	Hostname     string    `json:"hostname"`
+	CertFilePath string    `json:"certFilePath"`
+	IsAcme       bool      `json:"isAcme"`
+	DNSNames     []string  `json:"dnsNames"`
+	NotBefore    time.Time `json:"notBefore"`
+	NotAfter     time.Time `json:"notAfter"`
+	IsLoaded     bool      `json:"isLoaded"`
+}
+
+type certificateStoreEntry struct {
+	hostname string
+
+	// cert is replaced atomically when the files are reloaded.
+	cert atomic.Pointer[tls.Certificate]
+
+	certFilePath string
+	keyFilePath  string
+	fileModTime  time.Time
+
+	acmeManager        *autocert.Manager
+	acmeHttpMiddleware HttpMiddleware
+
+	clientAuth *certificateClientAuth
+}
+
+type certificateClientAuth struct {
+	authType tls.ClientAuthType
+	caPool   *x509.CertPool
+}
+
+func NewCertificateStore() *CertificateStore {
+	return &CertificateStore{
+		byHostname: make(map[string]*certificateStoreEntry),
+	}
+}
+
+// Add adds the certificate described by the params, which can be certificate files or Let's Encrypt.
+func (m *CertificateStore) Add(params HttpsCertificateParams) error {
+	var err error
+
+	if params.UseLetsEncrypt {
+		err = m.addLetsEncrypt(params)
+	} else {
+		err = m.AddCertificateFiles(params.Hostname, params.CertFilePath, params.KeyFilePath)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if params.ClientAuthMode != "" {
+		return m.SetHostClientAuth(params.Hostname, params.ClientAuthMode, params.ClientCaFile)
+	}
+
+	return nil
+}
+
+// SetClientAuth sets how the client certificates are asked and verified,
+// for the hosts which don't have their own settings.
+func (m *CertificateStore) SetClientAuth(mode ClientAuthMode, caFilePath string) error {
+	clientAuth, err := newCertificateClientAuth(mode, caFilePath)
+	if err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.clientAuth = clientAuth
+	return nil
+}
+
+// SetHostClientAuth sets how the client certificates are asked and verified for this host,
+// which must have been added before.
+func (m *CertificateStore) SetHostClientAuth(hostname string, mode ClientAuthMode, caFilePath string) error {
+	clientAuth, err := newCertificateClientAuth(mode, caFilePath)
+	if err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	entry := m.byHostname[strings.ToLower(hostname)]
+	if entry == nil {
+		return errors.New("no certificate for host " + hostname)
+	}
+
+	entry.clientAuth = clientAuth
+	return nil
+}
+
+func newCertificateClientAuth(mode ClientAuthMode, caFilePath string) (*certificateClientAuth, error) {
+	res := &certificateClientAuth{}
+
+	switch mode {
+	case "", ClientAuthNone:
+		res.authType = tls.NoClientCert
+		return res, nil
+	case ClientAuthOptional:
+		res.authType = tls.VerifyClientCertIfGiven
+	case ClientAuthRequired:
+		res.authType = tls.RequireAndVerifyClientCert
+	default:
+		return nil, errors.New("unknown client auth mode " + string(mode))
+	}
+
+	if caFilePath == "" {
+		return nil, errors.New("a client CA file is required to verify the client certificates")
+	}
+
+	caPem, err := os.ReadFile(toAbsolutePath(caFilePath))
+	if err != nil {
+		return nil, err
+	}
+
+	res.caPool = x509.NewCertPool()
+
+	if !res.caPool.AppendCertsFromPEM(caPem) {
+		return nil, errors.New("no certificate found in " + caFilePath)
+	}
+
+	return res, nil
+}
+
+// AddCertificateFiles adds a certificate from his files. Relative paths are relative to the current dir.
+// The hostname can be a wildcard like "*.example.com".
+func (m *CertificateStore) AddCertificateFiles(hostname string, certFilePath string, keyFilePath string) error {
+	certFilePath = toAbsolutePath(certFilePath)
+	keyFilePath = toAbsolutePath(keyFilePath)
+
+	entry := &certificateStoreEntry{
+		hostname:     hostname,
+		certFilePath: certFilePath,
+		keyFilePath:  keyFilePath,
+	}
+
+	err := entry.loadFiles()
+	if err != nil {
+		return err
+	}
+
+	m.addEntry(entry)
+	return nil
+}
+
+// AddCertificate adds a certificate which is already loaded in memory.
+func (m *CertificateStore) AddCertificate(hostname string, cert *tls.Certificate) error {
+	if cert.Leaf == nil {
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return err
+		}
+
+		cert.Leaf = leaf
+	}
+
+	entry := &certificateStoreEntry{hostname: hostname}
+	entry.cert.Store(cert)
+
+	m.addEntry(entry)
+	return nil
+}
+
+func (m *CertificateStore) addLetsEncrypt(params HttpsCertificateParams) error {
+	// Note: LetsEncrypt requires a CAA record on the DNS.
+	// It's why it can't be tested on a dev local server.
+	// See more: https://letsencrypt.org/docs/caa/
+	// Also for an alternative: https://go-acme.github.io/lego/installation/
+
+	manager, err := newAcmeManager(params)
+	if err != nil {
+		return err
+	}
+
+	entry := &certificateStoreEntry{hostname: params.Hostname, acmeManager: manager}
+
+	if params.AcmeChallengeType == AcmeChallengeHttp {
+		entry.acmeHttpMiddleware = buildAcmeHttpChallengeMiddleware(manager)
+	} else {
+		m.mutex.Lock()
+		m.useTlsAlpn = true
+		m.mutex.Unlock()
+	}
+
+	m.addEntry(entry)
+	return nil
+}
+
+// GetAcmeHttpMiddleware returns the middleware answering to the ACME http-01 challenge
+// for this hostname, or nil if this hostname doesn't use this challenge.
+// It must be bound to AcmeChallengePath + "*" of the plain http host.
+func (m *CertificateStore) GetAcmeHttpMiddleware(hostname string) HttpMiddleware {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	entry := m.byHostname[strings.ToLower(hostname)]
+	if entry == nil {
+		return nil
+	}
+
+	return entry.acmeHttpMiddleware
+}
+
+func (m *CertificateStore) addEntry(entry *certificateStoreEntry) {
+	entry.hostname = strings.ToLower(entry.hostname)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.byHostname[entry.hostname] = entry
+
+	// The first certificate is used when the browser doesn't send
+	// a hostname, which is the case when using the server IP.
+	if m.defaultEntry == nil {
+		m.defaultEntry = entry
+	}
+}
+
+// IsEmpty returns true if no certificate has been added.
+func (m *CertificateStore) IsEmpty() bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return len(m.byHostname) == 0
+}
+
+// TLSConfig returns a TLS configuration using this store.
+func (m *CertificateStore) TLSConfig() *tls.Config {
+	config := &tls.Config{GetCertificate: m.GetCertificate}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if m.useTlsAlpn {
+		config.NextProtos = []string{"http/1.1", acme.ALPNProto}
+	}
+
+	// Client certificates are asked according to the host.
+	config.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		return m.getConfigForClient(config, hello)
+	}
+
+	return config
+}
+
+// getConfigForClient returns the TLS configuration asking the client certificate
+// when required for the host, or nil to use the default configuration.
+func (m *CertificateStore) getConfigForClient(config *tls.Config, hello *tls.ClientHelloInfo) (*tls.Config, error) {
+	entry := m.findEntry(hello.ServerName)
+
+	m.mutex.RLock()
+	clientAuth := m.clientAuth
+
+	if (entry != nil) && (entry.clientAuth != nil) {
+		clientAuth = entry.clientAuth
+	}
+
+	m.mutex.RUnlock()
+
+	if (clientAuth == nil) || (clientAuth.authType == tls.NoClientCert) {
+		return nil, nil
+	}
+
+	res := config.Clone()
+	res.GetConfigForClient = nil
+	res.ClientAuth = clientAuth.authType
+	res.ClientCAs = clientAuth.caPool
+
+	return res, nil
+}
+
+// hasHostClientAuth returns true if the host has his own client certificate verification,
+// which asks a certificate.
+func (m *CertificateStore) hasHostClientAuth(hostname string) bool {
+	entry := m.findEntry(hostname)
+	if entry == nil {
+		return false
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return (entry.clientAuth != nil) && (entry.clientAuth.authType != tls.NoClientCert)
+}
+
+// GetCertificate returns the certificate for the hostname requested by the browser.
+// It's the function used by tls.Config.GetCertificate.
+func (m *CertificateStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	entry := m.findEntry(hello.ServerName)
+	if entry == nil {
+		return nil, errors.New("no certificate for host " + hello.ServerName)
+	}
+
+	if entry.acmeManager != nil {
+		cert, err := entry.acmeManager.GetCertificate(hello)
+
+		// Keep it for GetCertificatesInfos.
+		if (err == nil) && (cert.Leaf != nil) {
+			entry.cert.Store(cert)
+		}
+
+		return cert, err
+	}
+
+	return entry.cert.Load(), nil
+}
+
+func (m *CertificateStore) findEntry(hostname string) *certificateStoreEntry {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if hostname == "" {
+		return m.defaultEntry
+	}
+
+	hostname = strings.TrimSuffix(strings.ToLower(hostname), ".")
+
+	entry := m.byHostname[hostname]
+	if entry != nil {
+		return entry
+	}
+
+	// A wildcard certificate only matches one level of subdomain.
+	idx := strings.IndexByte(hostname, '.')
+	if idx == -1 {
+		return nil
+	}
+
+	return m.byHostname["*"+hostname[idx:]]
+}
+
+// GetCertificatesInfos returns information about the certificates,
+// mainly their expiration dates.
+func (m *CertificateStore) GetCertificatesInfos() []CertificateInfo {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	var res []CertificateInfo
+
+	for _, entry := range m.byHostname {
+		info := CertificateInfo{
+			Hostname:     entry.hostname,
+			CertFilePath: entry.certFilePath,
+			IsAcme:       entry.acmeManager != nil,
+		}
+
+		cert := entry.cert.Load()
+
+		if (cert != nil) && (cert.Leaf != nil) {
+			info.IsLoaded = true
+			info.DNSNames = cert.Leaf.DNSNames
+			info.NotBefore = cert.Leaf.NotBefore
+			info.NotAfter = cert.Leaf.NotAfter
+		}
+
+		res = append(res, info)
+	}
+
+	return res
+}
+
+// ReloadFiles reloads the certificate files which have been updated since they were loaded.
+// The new certificate replaces the old one atomically. If a file is invalid,
+// the old certificate is kept and the error is returned.
+func (m *CertificateStore) ReloadFiles() error {
+	m.reloadMutex.Lock()
+	defer m.reloadMutex.Unlock()
+
+	m.mutex.RLock()
+	var entries []*certificateStoreEntry
+
+	for _, entry := range m.byHostname {
+		if entry.certFilePath != "" {
+			entries = append(entries, entry)
+		}
+	}
+
+	m.mutex.RUnlock()
+
+	var foundError error
+
+	for _, entry := range entries {
+		if !entry.isFileUpdated() {
+			continue
+		}
+
+		err := entry.loadFiles()
+		if err != nil {
+			foundError = fmt.Errorf("can't reload the certificate of %s: %w", entry.certFilePath, err)
+		}
+	}
+
+	return foundError
+}
+
+// StartWatching checks the certificate files every interval and reloads the updated ones.
+func (m *CertificateStore) StartWatching(interval time.Duration) {
+	m.watchMutex.Lock()
+	defer m.watchMutex.Unlock()
+
+	if m.watchStop != nil {
+		return
+	}
+
+	stop := make(chan struct{})
+	m.watchStop = stop
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				// On error the old certificate is kept,
+				// and the next check will try again.
+				if err := m.ReloadFiles(); err != nil {
+					m.logReloadError(err)
+				}
+			}
+		}
+	}()
+}
+
+// logReloadError writes the error, allowing to see a failed renewal before the certificate expires.
+func (m *CertificateStore) logReloadError(err error) {
+	logger := log.Default()
+	if m.getLogger != nil {
+		logger = m.getLogger()
+	}
+
+	logger.Printf("certificate store: %s", err.Error())
+}
+
+// StopWatching stops the goroutine started by StartWatching.
+func (m *CertificateStore) StopWatching() {
+	m.watchMutex.Lock()
+	defer m.watchMutex.Unlock()
+
+	if m.watchStop != nil {
+		close(m.watchStop)
+		m.watchStop = nil
+	}
+}
+
+func (m *certificateStoreEntry) loadFiles() error {
+	modTime := m.getFileModTime()
+
+	cert, err := tls.LoadX509KeyPair(m.certFilePath, m.keyFilePath)
+	if err != nil {
+		return err
+	}
+
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return err
+	}
+
+	m.fileModTime = modTime
+	m.cert.Store(&cert)
+
+	return nil
+}
+
+func (m *certificateStoreEntry) isFileUpdated() bool {
+	return !m.getFileModTime().Equal(m.fileModTime)
+}
+
+// getFileModTime returns the most recent update date of the cert and key files.
+func (m *certificateStoreEntry) getFileModTime() time.Time {
+	var res time.Time
+
+	for _, filePath := range []string{m.certFilePath, m.keyFilePath} {
+		stat, err := os.Stat(filePath)
+
+		if (err == nil) && stat.ModTime().After(res) {
+			res = stat.ModTime()
+		}
+	}
+
+	return res
+}
+
+// toAbsolutePath returns the path, made absolute from the current dir if relative.
+func toAbsolutePath(filePath string) string {
+	if path.IsAbs(filePath) {
+		return filePath
+	}
+
+	cwd, _ := os.Getwd()
+	return path.Join(cwd, filePath)
+}
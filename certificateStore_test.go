@@ -0,0 +1,203 @@
+/*
+ * (C) Copyright 2024 Johan Michel PIQUET, France (https://johanpiquet.fr/).
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpServer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"log"
+	"math/big"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func writeTestCertificate(test *testing.T, dir string, hostname string, notAfter time.Time) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: hostname},
+		DNSNames:     []string{hostname},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+
+	certFilePath := path.Join(dir, "cert.pem")
+	keyFilePath := path.Join(dir, "key.pem")
+
+	_ = os.WriteFile(certFilePath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	_ = os.WriteFile(keyFilePath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+
+	return certFilePath, keyFilePath
+}
+
+func expectCertificate(test *testing.T, store *CertificateStore, serverName string, expectedDNSName string) {
+	cert, err := store.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+
+	if expectedDNSName == "" {
+		if err == nil {
+			test.Error("No certificate expected for [", serverName, "]")
+		}
+
+		return
+	}
+
+	if err != nil {
+		test.Error("Certificate not found for [", serverName, "]:", err)
+		return
+	}
+
+	if cert.Leaf.DNSNames[0] != expectedDNSName {
+		test.Error("Bad certificate for [", serverName, "]\n- Found [", cert.Leaf.DNSNames[0], "]\n- Expected [", expectedDNSName, "]")
+	}
+}
+
+func TestCertificateStoreSNI(test *testing.T) {
+	store := NewCertificateStore()
+
+	certFile, keyFile := writeTestCertificate(test, test.TempDir(), "example.com", time.Now().Add(time.Hour))
+	if err := store.AddCertificateFiles("example.com", certFile, keyFile); err != nil {
+		test.Fatal(err)
+	}
+
+	certFile, keyFile = writeTestCertificate(test, test.TempDir(), "*.example.com", time.Now().Add(time.Hour))
+	if err := store.AddCertificateFiles("*.example.com", certFile, keyFile); err != nil {
+		test.Fatal(err)
+	}
+
+	expectCertificate(test, store, "example.com", "example.com")
+	expectCertificate(test, store, "EXAMPLE.com.", "example.com")
+	expectCertificate(test, store, "www.example.com", "*.example.com")
+	expectCertificate(test, store, "a.b.example.com", "")
+	expectCertificate(test, store, "other.com", "")
+
+	// Without hostname, the first certificate is used.
+	expectCertificate(test, store, "", "example.com")
+}
+
+func TestCertificateStoreReload(test *testing.T) {
+	dir := test.TempDir()
+	store := NewCertificateStore()
+
+	firstExpiration := time.Now().Add(time.Hour).Truncate(time.Second)
+	certFile, keyFile := writeTestCertificate(test, dir, "example.com", firstExpiration)
+
+	if err := store.AddCertificateFiles("example.com", certFile, keyFile); err != nil {
+		test.Fatal(err)
+	}
+
+	infos := store.GetCertificatesInfos()
+	if (len(infos) != 1) || !infos[0].NotAfter.Equal(firstExpiration) {
+		test.Fatal("Invalid certificate infos", infos)
+	}
+
+	// Simulate a renewal, with a file update date which is different.
+	secondExpiration := firstExpiration.Add(time.Hour * 24 * 90)
+	writeTestCertificate(test, dir, "example.com", secondExpiration)
+
+	future := time.Now().Add(time.Minute)
+	_ = os.Chtimes(certFile, future, future)
+
+	if err := store.ReloadFiles(); err != nil {
+		test.Fatal(err)
+	}
+
+	infos = store.GetCertificatesInfos()
+	if !infos[0].NotAfter.Equal(secondExpiration) {
+		test.Error("Certificate not reloaded, expiration is", infos[0].NotAfter)
+	}
+
+	// An invalid file must keep the current certificate.
+	_ = os.WriteFile(certFile, []byte("invalid"), 0600)
+	future = future.Add(time.Minute)
+	_ = os.Chtimes(certFile, future, future)
+
+	if store.ReloadFiles() == nil {
+		test.Error("Reloading an invalid file must return an error")
+	}
+
+	expectCertificate(test, store, "example.com", "example.com")
+}
+
+type certificateLogBuffer struct {
+	mutex sync.Mutex
+	text  strings.Builder
+}
+
+func (m *certificateLogBuffer) Write(p []byte) (int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.text.Write(p)
+}
+
+func (m *certificateLogBuffer) String() string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.text.String()
+}
+
+func TestCertificateStoreWatchingErrors(test *testing.T) {
+	dir := test.TempDir()
+	store := NewCertificateStore()
+
+	buffer := &certificateLogBuffer{}
+	logger := log.New(buffer, "", 0)
+	store.getLogger = func() *log.Logger { return logger }
+
+	certFile, keyFile := writeTestCertificate(test, dir, "example.com", time.Now().Add(time.Hour))
+
+	if err := store.AddCertificateFiles("example.com", certFile, keyFile); err != nil {
+		test.Fatal(err)
+	}
+
+	// A broken renewal.
+	_ = os.WriteFile(certFile, []byte("invalid"), 0600)
+	future := time.Now().Add(time.Minute)
+	_ = os.Chtimes(certFile, future, future)
+
+	store.StartWatching(time.Millisecond * 10)
+	defer store.StopWatching()
+
+	for i := 0; (i < 100) && (buffer.String() == ""); i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	if !strings.Contains(buffer.String(), certFile) {
+		test.Error("The reload error must be logged, found [", buffer.String(), "]")
+	}
+
+	expectCertificate(test, store, "example.com", "example.com")
+}
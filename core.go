@@ -17,8 +17,17 @@
 package httpServer
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
 	"mime/multipart"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -26,11 +35,69 @@ import (
 
 type HttpServer interface {
 	GetPort() int
+
+	// GetBindAddress returns the address the server listens to, without the port.
+	// It's empty when listening to all the interfaces. See StartParams.GetListenAddress.
+	GetBindAddress() string
+
 	IsStarted() bool
-	Shutdown()
+
+	// Shutdown stops the server. New connections are refused and the requests
+	// in progress have until the timeout to finish, after what the remaining
+	// connections are closed. A timeout <= 0 means using the default timeout.
+	// Returns true if all the requests have finished before the timeout.
+	Shutdown(timeout time.Duration) bool
+
+	// StartServer starts the server and blocks until the server is stopped.
 	StartServer() error
+
+	// Start starts the server without blocking. Returns once the socket is
+	// listening, or returns the error if the socket can't be bound.
+	Start() error
+
+	// Wait blocks until the server is stopped and returns the error having stopped it.
+	Wait() error
+
+	// Done returns a channel which is closed once the server is stopped.
+	Done() <-chan struct{}
+
+	// GetHost returns the host with this name, creating it if needed. The name can be
+	// a wildcard like "*.example.com", or "*" for the default host. The port is ignored.
 	GetHost(hostName string) *HttpHost
+
+	// AddHostAlias allows the host to also answer to another name, sharing his routes.
+	// If redirectToHost is true, the requests for the alias are redirected to the name of the host.
+	AddHostAlias(alias string, host *HttpHost, redirectToHost bool) error
+
+	// SetDefaultHost sets the host receiving the requests for which no host matches.
+	SetDefaultHost(host *HttpHost)
+
+	// SetUnknownHostHandler sets what to do when no host matches the request
+	// and there is no default host. Default is UnknownHostNotFound.
+	SetUnknownHostHandler(handler UnknownHostHandler)
+
 	SetStartServerParams(params StartParams)
+
+	// GetLogger returns the logger where the errors are written.
+	// When StartParams.HideErrors is set, the default logger discards everything.
+	GetLogger() *log.Logger
+
+	// SetLogger sets the logger where the errors are written. Nil restores the default logger.
+	SetLogger(logger *log.Logger)
+
+	// SetPanicHandler sets the function called when a request panics.
+	// The request then receives a 500 error. Default is writing the panic to the logger.
+	SetPanicHandler(handler PanicHandler)
+
+	// SetRequestHooks sets the hooks called for all the requests, allowing to observe them. Nil removes them.
+	SetRequestHooks(hooks *HttpRequestHooks)
+
+	// GetRequestHooks returns the hooks set with SetRequestHooks, or nil.
+	GetRequestHooks() *HttpRequestHooks
+
+	// GetCertificateStore returns the store containing the https certificates.
+	// Returns nil if the server isn't started with https.
+	GetCertificateStore() *CertificateStore
 }
 
 type HttpsCertificateParams struct {
@@ -40,6 +107,40 @@ type HttpsCertificateParams struct {
 
 	UseLetsEncrypt bool
 	CertCacheDir   string `json:"certCacheDir"`
+
+	// AcmeDirectoryUrl is the directory of the ACME server.
+	// Default is the production directory of Let's Encrypt.
+	AcmeDirectoryUrl string `json:"acmeDirectoryUrl"`
+
+	// AcmeDirectoryCaFile is a PEM file with the CA certificate of the ACME server,
+	// when it's an internal CA not trusted by the system.
+	AcmeDirectoryCaFile string `json:"acmeDirectoryCaFile"`
+
+	// AcmeEmail is the contact email of the ACME account.
+	AcmeEmail string `json:"acmeEmail"`
+
+	// AcmeEabKeyId and AcmeEabHmacKey are the External Account Binding credentials,
+	// required by some ACME servers. The hmac key is encoded with base64url.
+	AcmeEabKeyId   string `json:"acmeEabKeyId"`
+	AcmeEabHmacKey string `json:"acmeEabHmacKey"`
+
+	// AcmeChallengeType is AcmeChallengeTlsAlpn (default) or AcmeChallengeHttp.
+	// AcmeChallengeHttp requires StartParams.HttpsPort, since the challenge is answered
+	// by the plain http port while the server port is only https without it.
+	AcmeChallengeType string `json:"acmeChallengeType"`
+
+	// ClientAuthMode and ClientCaFile allow asking a client certificate for this host.
+	// When not set, the values of StartParams are used.
+	ClientAuthMode ClientAuthMode `json:"clientAuthMode"`
+	ClientCaFile   string         `json:"clientCaFile"`
+
+	// ForceHttps allows redirecting to https the requests sent with http.
+	ForceHttps bool `json:"forceHttps"`
+
+	// HstsMaxAgeInSec allows sending a "Strict-Transport-Security" header,
+	// asking browsers to only use https for this host.
+	HstsMaxAgeInSec       int  `json:"hstsMaxAgeInSec"`
+	HstsIncludeSubDomains bool `json:"hstsIncludeSubDomains"`
 }
 
 // StartParams will contain information on how
@@ -49,27 +150,211 @@ type StartParams struct {
 	HideErrors   bool                     `json:"hideErrors"`
 	EnableHttps  bool                     `json:"enableHttps"`
 	Certificates []HttpsCertificateParams `json:"certificates"`
+
+	// HttpsPort allows serving http and https at the same time. When set with EnableHttps,
+	// the server port is used for http and this port for https.
+	// Without it, the server port is only used for https.
+	HttpsPort int `json:"httpsPort"`
+
+	// DevCertificates allows generating certificates for local development, signed
+	// by a local CA. When set, https is enabled even if EnableHttps isn't set.
+	DevCertificates *DevCertificatesParams `json:"devCertificates"`
+
+	// ClientAuthMode allows asking the clients for a certificate (mutual TLS), which is
+	// verified with the CA certificates of ClientCaFile. Default is ClientAuthNone.
+	ClientAuthMode ClientAuthMode `json:"clientAuthMode"`
+
+	// ClientCaFile is a PEM file with the CA certificates used to verify the client certificates.
+	ClientCaFile string `json:"clientCaFile"`
+
+	// CertificatesCheckIntervalInSec is the interval between two checks of the certificate files.
+	// Updated files are reloaded without restarting the server. Default is 60 seconds.
+	CertificatesCheckIntervalInSec int `json:"certificatesCheckIntervalInSec"`
+
+	// MaxRequestBodySize is the max size in bytes of the request body.
+	// Default is 4Mo.
+	MaxRequestBodySize int `json:"maxRequestBodySize"`
+
+	// MaxHeaderSize is the max size in bytes of the request headers.
+	// Default is 4Ko with FastHttpServer, and 1Mo with NetHttpServer (the net/http default).
+	MaxHeaderSize int `json:"maxHeaderSize"`
+
+	// ReadTimeoutInSec is the max time for receiving the complete request.
+	// Default is 10 seconds.
+	ReadTimeoutInSec int `json:"readTimeoutInSec"`
+
+	// WriteTimeoutInSec is the max time for sending the response.
+	// Default is no limit.
+	WriteTimeoutInSec int `json:"writeTimeoutInSec"`
+
+	// IdleTimeoutInSec is the max time a keep-alive connection waits for the next request.
+	// Default is the read timeout.
+	IdleTimeoutInSec int `json:"idleTimeoutInSec"`
+
+	// MaxConcurrency is the max number of connections served at the same time.
+	// Default is 256K.
+	MaxConcurrency int `json:"maxConcurrency"`
+
+	// MaxConnsPerIP is the max number of connections for one client IP.
+	// Default is no limit.
+	MaxConnsPerIP int `json:"maxConnsPerIP"`
+
+	// DisableKeepAlive allows closing the connection after each response.
+	DisableKeepAlive bool `json:"disableKeepAlive"`
+
+	// ServerName is the value of the "Server" response header.
+	// Default is a fake name, making less simple to known what server technologies is used.
+	ServerName string `json:"serverName"`
+
+	// HideServerName allows to not send the "Server" header.
+	HideServerName bool `json:"hideServerName"`
+
+	// EnableH2c allows HTTP/2 without TLS (h2c), used by gRPC style clients.
+	// Only supported by the servers of libNetHttpImpl, which always use HTTP/2 with https.
+	EnableH2c bool `json:"enableH2c"`
+
+	// BindAddress is the IP address to listen to, for example "127.0.0.1" or "::1".
+	// Default is listening to all the interfaces.
+	BindAddress string `json:"bindAddress"`
+
+	// UnixSocketPath allows listening to a unix domain socket instead of a TCP port.
+	UnixSocketPath string `json:"unixSocketPath"`
+
+	// UnixSocketFileMode is the file mode of the unix socket. Default is 0660.
+	UnixSocketFileMode os.FileMode `json:"unixSocketFileMode"`
+
+	// Listener allows using a listener created by the caller.
+	// When set, BindAddress and UnixSocketPath are ignored.
+	Listener net.Listener `json:"-"`
+}
+
+// IsHttpsEnabled returns true if https is enabled, or if development certificates are used.
+func (m *StartParams) IsHttpsEnabled() bool {
+	return m.EnableHttps || (m.DevCertificates != nil)
+}
+
+// GetListenAddress returns the address identifying where the server listens.
+// It's the bind address for TCP, or the socket path prefixed by "unix:" for unix sockets.
+func (m *StartParams) GetListenAddress() string {
+	if m.Listener != nil {
+		return "listener:" + m.Listener.Addr().String()
+	}
+
+	if m.UnixSocketPath != "" {
+		return "unix:" + m.UnixSocketPath
+	}
+
+	return m.BindAddress
 }
 
-// GetHttpServer allows to get the server instance
-// listening to the given port. OnReturnStringAction nil if no one.
+// GetHttpServer allows to get the server instance listening
+// to the given port on all interfaces. Returns nil if no one.
 func GetHttpServer(port int) HttpServer {
-	gServerByPortMutex.RLock()
-	s := gServerByPort[port]
-	gServerByPortMutex.RUnlock()
+	return GetHttpServerAt("", port)
+}
+
+// GetHttpServerAt allows to get the server instance listening
+// to the given address and port. Returns nil if no one.
+func GetHttpServerAt(bindAddress string, port int) HttpServer {
+	gServerByAddressMutex.RLock()
+	s := gServerByAddress[serverAddress{bindAddress: bindAddress, port: port}]
+	gServerByAddressMutex.RUnlock()
 	return s
 }
 
 // RegisterServer allows registering a server instance
-// in a map allowing to known listened port <--> server.
+// in a map allowing to known listened address <--> server.
 func RegisterServer(server HttpServer) {
-	gServerByPortMutex.Lock()
-	gServerByPort[server.GetPort()] = server
-	gServerByPortMutex.Unlock()
+	gServerByAddressMutex.Lock()
+	gServerByAddress[serverAddress{bindAddress: server.GetBindAddress(), port: server.GetPort()}] = server
+	gServerByAddressMutex.Unlock()
+}
+
+// UnregisterServer removes the server from the map listened address <--> server.
+// Allows GetHttpServer to not return this instance once the server is stopped.
+// Returns true if the server was registered.
+func UnregisterServer(server HttpServer) bool {
+	gServerByAddressMutex.Lock()
+	defer gServerByAddressMutex.Unlock()
+
+	isFound := false
+
+	for key, value := range gServerByAddress {
+		if value == server {
+			delete(gServerByAddress, key)
+			isFound = true
+		}
+	}
+
+	return isFound
 }
 
-var gServerByPort = make(map[int]HttpServer)
-var gServerByPortMutex sync.RWMutex
+type serverAddress struct {
+	bindAddress string
+	port        int
+}
+
+var gServerByAddress = make(map[serverAddress]HttpServer)
+var gServerByAddressMutex sync.RWMutex
+
+//endregion
+
+//region Client certificates
+
+// ClientAuthMode tells if a client certificate is asked when using https.
+type ClientAuthMode string
+
+// ClientAuthNone means that no client certificate is asked.
+const ClientAuthNone = ClientAuthMode("none")
+
+// ClientAuthOptional means that a client certificate is asked, and verified if sent.
+const ClientAuthOptional = ClientAuthMode("optional")
+
+// ClientAuthRequired means that the client must send a valid certificate.
+const ClientAuthRequired = ClientAuthMode("required")
+
+// HttpClientCertificate is the certificate sent by the client,
+// once verified with the client CA certificates.
+type HttpClientCertificate struct {
+	// Chain is the verified chain, starting with the client certificate.
+	Chain []*x509.Certificate
+
+	Subject        string
+	CommonName     string
+	DNSNames       []string
+	EmailAddresses []string
+	URIs           []string
+	IPAddresses    []string
+}
+
+// NewHttpClientCertificate returns the verified client certificate of a TLS connection,
+// or nil if the client hasn't sent a valid certificate.
+func NewHttpClientCertificate(state *tls.ConnectionState) *HttpClientCertificate {
+	if (state == nil) || (len(state.VerifiedChains) == 0) || (len(state.VerifiedChains[0]) == 0) {
+		return nil
+	}
+
+	chain := state.VerifiedChains[0]
+	leaf := chain[0]
+
+	res := &HttpClientCertificate{
+		Chain:          chain,
+		Subject:        leaf.Subject.String(),
+		CommonName:     leaf.Subject.CommonName,
+		DNSNames:       leaf.DNSNames,
+		EmailAddresses: leaf.EmailAddresses,
+	}
+
+	for _, uri := range leaf.URIs {
+		res.URIs = append(res.URIs, uri.String())
+	}
+
+	for _, ip := range leaf.IPAddresses {
+		res.IPAddresses = append(res.IPAddresses, ip.String())
+	}
+
+	return res
+}
 
 //endregion
 
@@ -80,6 +365,10 @@ type HttpRequest interface {
 	GetMethodCode() HttpMethod
 	GetContentLength() int
 
+	// IsHead returns true for a HEAD request. The body isn't sent, but his size is,
+	// so a handler can skip the work done to build the body only if he knows his size.
+	IsHead() bool
+
 	IsBodySend() bool
 
 	GetContentType() string
@@ -101,12 +390,20 @@ type HttpRequest interface {
 	SetCookie(key string, value string, cookie HttpCookieOptions) error
 
 	Path() string
+
+	// SetPath allows a middleware added with HttpHost.Use to change the path used to find the route.
+	SetPath(path string)
+
 	URI() UriReader
 	FullURI() string
 
 	UserAgent() string
 	RemoteIP() string
 
+	// GetClientCertificate returns the certificate sent by the client, once verified.
+	// Returns nil if the client hasn't sent a certificate. See StartParams.ClientAuthMode.
+	GetClientCertificate() *HttpClientCertificate
+
 	GetHost() *HttpHost
 
 	Return500ErrorPage(err error)
@@ -119,6 +416,10 @@ type HttpRequest interface {
 
 	GetWildcards() []string
 
+	// GetParam returns the value of a named parameter of the route, like "id" for "/users/:id".
+	// Returns an empty string if the route has no such parameter.
+	GetParam(name string) string
+
 	SendFile(filePath string) error
 	SendFileAsIs(filePath string, mimeType string, contentEncoding string) error
 }
@@ -157,6 +458,10 @@ func (m *HttpRequestResponseSpy) GetContentLength() int {
 	return m.req.GetContentLength()
 }
 
+func (m *HttpRequestResponseSpy) IsHead() bool {
+	return m.req.IsHead()
+}
+
 func (m *HttpRequestResponseSpy) IsBodySend() bool {
 	return m.req.IsBodySend()
 }
@@ -217,6 +522,10 @@ func (m *HttpRequestResponseSpy) Path() string {
 	return m.req.Path()
 }
 
+func (m *HttpRequestResponseSpy) SetPath(path string) {
+	m.req.SetPath(path)
+}
+
 func (m *HttpRequestResponseSpy) URI() UriReader {
 	return m.req.URI()
 }
@@ -233,6 +542,10 @@ func (m *HttpRequestResponseSpy) RemoteIP() string {
 	return m.req.RemoteIP()
 }
 
+func (m *HttpRequestResponseSpy) GetClientCertificate() *HttpClientCertificate {
+	return m.req.GetClientCertificate()
+}
+
 func (m *HttpRequestResponseSpy) GetHost() *HttpHost {
 	return m.req.GetHost()
 }
@@ -263,6 +576,10 @@ func (m *HttpRequestResponseSpy) GetWildcards() []string {
 	return m.req.GetWildcards()
 }
 
+func (m *HttpRequestResponseSpy) GetParam(name string) string {
+	return m.req.GetParam(name)
+}
+
 func (m *HttpRequestResponseSpy) SendFileAsIs(filePath string, contentType string, contentEncoding string) error {
 	m.IsSendingFile = filePath
 	m.ContentType = contentType
@@ -329,11 +646,67 @@ const CookieSameSiteNoneMode = CookieSameSite(4)
 //region Hosts
 
 type HttpHost struct {
-	impl         HttpHostImpl
-	server       HttpServer
-	hostName     string
+	impl       HttpHostImpl
+	server     HttpServer
+	hostName   string
+	allowHttps bool
+	forceHttps bool
+	hstsHeader string
+
+	routingPolicy HttpRoutingPolicy
+
+	// routes is replaced at once by ReplaceRoutes and Reset.
+	// The dispatcher loads it once per request.
+	routes atomic.Pointer[httpRouteTable]
+
+	// handlers contains the middlewares and the hooks of the host, which are kept
+	// when the routes are replaced. It's replaced by a modified copy when they change.
+	handlers      atomic.Pointer[httpHostHandlers]
+	handlersMutex sync.Mutex
+
+	// namesMutex is locked when adding a named route, whose name must be unique for all the methods.
+	namesMutex sync.Mutex
+
+	aliases      []HttpHostAlias
+	aliasesMutex sync.RWMutex
+
+	errorHandler    HttpErrorHandler
+	notFoundHandler HttpErrorHandler
+
+	// draftOf is the host for which ReplaceRoutes builds the routes, when this host is a draft.
+	draftOf *HttpHost
+}
+
+// httpRouteTable contains the routes of a host, with one UrlResolver for each method.
+type httpRouteTable struct {
 	urlResolvers []*UrlResolver
-	allowHttps   bool
+}
+
+// httpHostHandlers contains what is called for all the requests of a host.
+type httpHostHandlers struct {
+	// middlewares are the middlewares added with HttpHost.Use.
+	middlewares []HttpMiddleware
+
+	responseHooks []HttpResponseHook
+}
+
+func newHttpRouteTable() *httpRouteTable {
+	count := int(HttpMethodPATCH) + 1
+	res := &httpRouteTable{urlResolvers: make([]*UrlResolver, count)}
+
+	for i := 0; i < count; i++ {
+		res.urlResolvers[i] = NewUrlResolver()
+	}
+
+	return res
+}
+
+// HttpHostAlias is another name a host answers to.
+type HttpHostAlias struct {
+	Name string
+
+	// RedirectToHost is true if the requests for this name are redirected to the name of the host.
+	RedirectToHost bool
 }
 
 type HttpHostImpl interface {
@@ -349,18 +722,17 @@ type HttpHostInfos struct {
 // HttpMiddleware is a function the system can call when a request occurs.
 type HttpMiddleware func(call HttpRequest) error
 
+// HttpResponseHook is a function called once the response of a request is sent,
+// with the status of the response.
+type HttpResponseHook func(call HttpRequest, status int)
+
 func NewHttpHost(hostName string, server HttpServer, impl HttpHostImpl) *HttpHost {
 	res := &HttpHost{
 		hostName: hostName,
 		server:   server,
 	}
 
-	count := int(HttpMethodPATCH) + 1
-	res.urlResolvers = make([]*UrlResolver, count)
-
-	for i := 0; i < count; i++ {
-		res.urlResolvers[i] = NewUrlResolver()
-	}
+	res.routes.Store(newHttpRouteTable())
 
 	return res
 }
@@ -369,11 +741,56 @@ func (m *HttpHost) AllowHttps() {
 	m.allowHttps = true
 }
 
+func (m *HttpHost) IsHttpsAllowed() bool {
+	return m.allowHttps
+}
+
+// ForceHttps makes the requests sent with http to be redirected to https.
+// The redirection uses a 301 for GET and HEAD, and a 308 for the other methods.
+func (m *HttpHost) ForceHttps() {
+	m.allowHttps = true
+	m.forceHttps = true
+}
+
+func (m *HttpHost) IsHttpsForced() bool {
+	return m.forceHttps
+}
+
+// SetHsts allows sending the header "Strict-Transport-Security" with the https responses.
+// A maxAgeInSec of 0 disables the header.
+func (m *HttpHost) SetHsts(maxAgeInSec int, includeSubDomains bool, preload bool) {
+	if maxAgeInSec <= 0 {
+		m.hstsHeader = ""
+		return
+	}
+
+	header := "max-age=" + strconv.Itoa(maxAgeInSec)
+
+	if includeSubDomains {
+		header += "; includeSubDomains"
+	}
+
+	if preload {
+		header += "; preload"
+	}
+
+	m.hstsHeader = header
+}
+
+// GetHstsHeader returns the value of the "Strict-Transport-Security" header, or an empty string.
+func (m *HttpHost) GetHstsHeader() string {
+	return m.hstsHeader
+}
+
 func (m *HttpHost) Impl() HttpHostImpl {
 	return m.impl
 }
 
+// Reset removes all the routes. The requests being processed aren't impacted.
+// The middlewares added with Use and the hooks added with OnResponse are kept.
 func (m *HttpHost) Reset() {
+	m.routes.Store(newHttpRouteTable())
+
 	if m.impl != nil {
 		m.impl.Reset(m)
 	}
@@ -387,68 +804,326 @@ func (m *HttpHost) GetServer() HttpServer {
 	return m.server
 }
 
+// AddAlias allows the host to also answer to another name, sharing his routes.
+// If redirectToHost is true, the requests for the alias are redirected to the name of the host.
+func (m *HttpHost) AddAlias(alias string, redirectToHost bool) error {
+	return m.server.AddHostAlias(alias, m, redirectToHost)
+}
+
+// GetAliases returns the other names this host answers to.
+func (m *HttpHost) GetAliases() []HttpHostAlias {
+	m.aliasesMutex.RLock()
+	defer m.aliasesMutex.RUnlock()
+
+	res := make([]HttpHostAlias, len(m.aliases))
+	copy(res, m.aliases)
+
+	return res
+}
+
+func (m *HttpHost) addAlias(alias HttpHostAlias) {
+	m.aliasesMutex.Lock()
+	defer m.aliasesMutex.Unlock()
+
+	for i, current := range m.aliases {
+		if current.Name == alias.Name {
+			m.aliases[i] = alias
+			return
+		}
+	}
+
+	m.aliases = append(m.aliases, alias)
+}
+
 func (m *HttpHost) VERB(verb string, path string, h HttpMiddleware) {
-	m.urlResolvers[MethodNameToMethodCode(verb)].Add(path, h, m)
+	m.addRoute(MethodNameToMethodCode(verb), path, h)
 }
 
 func (m *HttpHost) GET(path string, h HttpMiddleware) {
-	m.urlResolvers[HttpMethodGET].Add(path, h, m)
+	m.addRoute(HttpMethodGET, path, h)
 }
 
 func (m *HttpHost) POST(path string, h HttpMiddleware) {
-	m.urlResolvers[HttpMethodPOST].Add(path, h, m)
+	m.addRoute(HttpMethodPOST, path, h)
 }
 
 func (m *HttpHost) HEAD(path string, h HttpMiddleware) {
-	m.urlResolvers[HttpMethodHEAD].Add(path, h, m)
+	m.addRoute(HttpMethodHEAD, path, h)
 }
 
 func (m *HttpHost) PUT(path string, h HttpMiddleware) {
-	m.urlResolvers[HttpMethodPUT].Add(path, h, m)
+	m.addRoute(HttpMethodPUT, path, h)
 }
 
 func (m *HttpHost) DELETE(path string, h HttpMiddleware) {
-	m.urlResolvers[HttpMethodDELETE].Add(path, h, m)
+	m.addRoute(HttpMethodDELETE, path, h)
 }
 
 func (m *HttpHost) TRACE(path string, h HttpMiddleware) {
-	m.urlResolvers[HttpMethodTRACE].Add(path, h, m)
+	m.addRoute(HttpMethodTRACE, path, h)
 }
 
 func (m *HttpHost) OPTIONS(path string, h HttpMiddleware) {
-	m.urlResolvers[HttpMethodOPTIONS].Add(path, h, m)
+	m.addRoute(HttpMethodOPTIONS, path, h)
 }
 
 func (m *HttpHost) CONNECT(path string, h HttpMiddleware) {
-	m.urlResolvers[HttpMethodCONNECT].Add(path, h, m)
+	m.addRoute(HttpMethodCONNECT, path, h)
 }
 
 func (m *HttpHost) PATCH(path string, h HttpMiddleware) {
-	m.urlResolvers[HttpMethodPATCH].Add(path, h, m)
+	m.addRoute(HttpMethodPATCH, path, h)
 }
 
 func (m *HttpHost) AllVerbs(path string, h HttpMiddleware) {
-	m.urlResolvers[HttpMethodGET].Add(path, h, m)
-	m.urlResolvers[HttpMethodPOST].Add(path, h, m)
-	m.urlResolvers[HttpMethodHEAD].Add(path, h, m)
-	m.urlResolvers[HttpMethodPUT].Add(path, h, m)
-	m.urlResolvers[HttpMethodDELETE].Add(path, h, m)
-	m.urlResolvers[HttpMethodCONNECT].Add(path, h, m)
-	m.urlResolvers[HttpMethodOPTIONS].Add(path, h, m)
-	m.urlResolvers[HttpMethodTRACE].Add(path, h, m)
-	m.urlResolvers[HttpMethodPATCH].Add(path, h, m)
+	m.addRoute(HttpMethodGET, path, h)
+	m.addRoute(HttpMethodPOST, path, h)
+	m.addRoute(HttpMethodHEAD, path, h)
+	m.addRoute(HttpMethodPUT, path, h)
+	m.addRoute(HttpMethodDELETE, path, h)
+	m.addRoute(HttpMethodCONNECT, path, h)
+	m.addRoute(HttpMethodOPTIONS, path, h)
+	m.addRoute(HttpMethodTRACE, path, h)
+	m.addRoute(HttpMethodPATCH, path, h)
+}
+
+// NamedRoute adds a route like VERB, with a name allowing to build his url with URLFor.
+// An error is returned if the name is already used by a route with another method or another path.
+func (m *HttpHost) NamedRoute(name string, verb string, path string, h HttpMiddleware) error {
+	return m.addNamedRoute(MethodNameToMethodCode(verb), name, path, h)
+}
+
+// URLFor returns the url of the route added with this name, where the named parameters are replaced
+// by the escaped values of params, followed by the query string. Params can be nil.
+// An error is returned if the route doesn't exist, or if a param is missing or unknown.
+func (m *HttpHost) URLFor(name string, params map[string]string, query url.Values) (string, error) {
+	for _, resolver := range m.routes.Load().urlResolvers {
+		pattern, found := resolver.GetNamedPattern(name)
+		if !found {
+			continue
+		}
+
+		res, err := buildUrlPath(pattern, params)
+		if err != nil {
+			return "", err
+		}
+
+		if len(query) != 0 {
+			res += "?" + query.Encode()
+		}
+
+		return res, nil
+	}
+
+	return "", fmt.Errorf("there is no route named %q", name)
+}
+
+func (m *HttpHost) addRoute(methodCode HttpMethod, path string, h HttpMiddleware) {
+	m.addNamedRoute(methodCode, "", path, h)
+}
+
+func (m *HttpHost) addNamedRoute(methodCode HttpMethod, name string, path string, h HttpMiddleware) error {
+	tag := m
+	if m.draftOf != nil {
+		tag = m.draftOf
+	}
+
+	if name == "" {
+		m.GetUrlResolver(methodCode).Add(path, h, tag)
+		return nil
+	}
+
+	// Avoids two routes with the same name being added at the same time for two methods.
+	m.namesMutex.Lock()
+	defer m.namesMutex.Unlock()
+
+	for otherMethodCode, resolver := range m.routes.Load().urlResolvers {
+		if HttpMethod(otherMethodCode) == methodCode {
+			continue
+		}
+
+		if pattern, found := resolver.GetNamedPattern(name); found {
+			return fmt.Errorf("the route name %q is already used by %s %q", name, MethodCodeToMethodName(HttpMethod(otherMethodCode)), pattern)
+		}
+	}
+
+	return m.GetUrlResolver(methodCode).AddNamed(name, path, h, tag)
 }
 
+// RemoveRoute removes the handler added for this method and this path, returning false if there is none.
+// It can be called while the host receives requests. Replacing several routes at once is done with ReplaceRoutes.
+func (m *HttpHost) RemoveRoute(verb string, path string) bool {
+	return m.GetUrlResolver(MethodNameToMethodCode(verb)).Remove(path)
+}
+
+// ReplaceRoutes allows building a new set of routes, which replaces the current routes at once.
+// The build function receives a draft host, where the routes are added like with the real host.
+// Only the routes of the draft are used. If the build function returns an error, nothing is replaced.
+//
+// The middlewares added with Use and the hooks added with OnResponse aren't part of the routes:
+// they are kept, and calling Use or OnResponse on the draft adds them directly to this host.
+//
+// The requests being processed continue using the old routes, while the new requests use the new routes.
+func (m *HttpHost) ReplaceRoutes(build func(draft *HttpHost) error) error {
+	draft := &HttpHost{
+		hostName: m.hostName,
+		server:   m.server,
+		draftOf:  m,
+	}
+
+	draft.routes.Store(newHttpRouteTable())
+
+	err := build(draft)
+	if err != nil {
+		return err
+	}
+
+	m.routes.Store(draft.routes.Load())
+
+	return nil
+}
+
+// Use adds middlewares which are called for all the requests of the host, before searching the route.
+// They can change the path used to find the route with HttpRequest.SetPath, or stop the request
+// by sending a response or calling HttpRequest.StopRequest. They are also called when no route matches.
+func (m *HttpHost) Use(middlewares ...HttpMiddleware) {
+	m.updateHandlers(func(handlers *httpHostHandlers) {
+		handlers.middlewares = append(append([]HttpMiddleware(nil), handlers.middlewares...), middlewares...)
+	})
+}
+
+// OnResponse adds a hook called once the response of a request is sent, with the final status.
+// It's called for all the requests of the host, including the errors and the redirections.
+func (m *HttpHost) OnResponse(hook HttpResponseHook) {
+	m.updateHandlers(func(handlers *httpHostHandlers) {
+		handlers.responseHooks = append(append([]HttpResponseHook(nil), handlers.responseHooks...), hook)
+	})
+}
+
+// GetMiddlewares returns the middlewares added with Use.
+func (m *HttpHost) GetMiddlewares() []HttpMiddleware {
+	if handlers := m.handlers.Load(); handlers != nil {
+		return handlers.middlewares
+	}
+
+	return nil
+}
+
+// GetResponseHooks returns the hooks added with OnResponse.
+func (m *HttpHost) GetResponseHooks() []HttpResponseHook {
+	if handlers := m.handlers.Load(); handlers != nil {
+		return handlers.responseHooks
+	}
+
+	return nil
+}
+
+// updateHandlers replaces the handlers by a copy modified by the function,
+// without impacting the requests being processed. For a draft, the handlers of its host are modified.
+func (m *HttpHost) updateHandlers(update func(handlers *httpHostHandlers)) {
+	if m.draftOf != nil {
+		m.draftOf.updateHandlers(update)
+		return
+	}
+
+	m.handlersMutex.Lock()
+	defer m.handlersMutex.Unlock()
+
+	var handlers httpHostHandlers
+
+	if current := m.handlers.Load(); current != nil {
+		handlers = *current
+	}
+
+	update(&handlers)
+	m.handlers.Store(&handlers)
+}
+
+// GetAllowedMethods returns the names of the methods having a route for this path.
+// OPTIONS is always included, since the server answers to it automatically.
+// The routes are matched following the routing policy of the host.
+func (m *HttpHost) GetAllowedMethods(path string) []string {
+	policy := m.GetRoutingPolicy()
+	return m.routes.Load().getAllowedMethods(path, &policy)
+}
+
+func (m *httpRouteTable) getAllowedMethods(path string, policy *HttpRoutingPolicy) []string {
+	var res []string
+
+	for methodCode := range m.urlResolvers {
+		if HttpMethod(methodCode) == HttpMethodOPTIONS {
+			continue
+		}
+
+		if resolvedUrl, _ := m.findWithPolicy(HttpMethod(methodCode), path, policy); resolvedUrl.Target == nil {
+			continue
+		}
+
+		res = append(res, MethodCodeToMethodName(HttpMethod(methodCode)))
+	}
+
+	if res != nil {
+		res = append(res, "OPTIONS")
+	}
+
+	return res
+}
+
+// GetUrlResolver returns the routes of this method.
+// The dispatcher reads all the routes once per request, which is why the requests
+// being processed keep the old routes after ReplaceRoutes.
 func (m *HttpHost) GetUrlResolver(methodCode HttpMethod) *UrlResolver {
-	return m.urlResolvers[methodCode]
+	return m.routes.Load().urlResolvers[methodCode]
+}
+
+// SetErrorHandler sets the handler writing the response when a middleware returns an error.
+// Nil restores DefaultErrorHandler. The 5xx errors are logged with the logger of the server,
+// except the panics which are reported by the panic handler. The 4xx errors are not logged.
+func (m *HttpHost) SetErrorHandler(handler HttpErrorHandler) {
+	m.errorHandler = handler
+}
+
+// SetNotFoundHandler sets the handler writing the response when no route matches the request.
+// Nil restores DefaultErrorHandler.
+func (m *HttpHost) SetNotFoundHandler(handler HttpErrorHandler) {
+	m.notFoundHandler = handler
 }
 
 func (m *HttpHost) OnError(req HttpRequest, err error) {
-	req.ReturnString(500, "error")
+	status := getErrorStatus(err)
+
+	if m == nil {
+		DefaultErrorHandler(req, status, err)
+		return
+	}
+
+	// Client errors are expected, only the server errors are logged.
+	// The panics are already reported by the panic handler.
+	if _, isPanic := err.(*PanicError); (err != nil) && (status >= 500) && !isPanic && (m.server != nil) {
+		m.server.GetLogger().Printf("error on %s %s%s: %s", req.GetMethodName(), m.hostName, req.Path(), err.Error())
+	}
+
+	if httpError := AsHttpError(err); httpError != nil {
+		for key, value := range httpError.Headers {
+			req.SetHeader(key, value)
+		}
+	}
+
+	handler := m.errorHandler
+	if handler == nil {
+		handler = DefaultErrorHandler
+	}
+
+	handler(req, status, err)
 }
 
 func (m *HttpHost) OnNotFound(req HttpRequest) {
-	req.ReturnString(404, "not found")
+	if (m == nil) || (m.notFoundHandler == nil) {
+		DefaultErrorHandler(req, 404, nil)
+		return
+	}
+
+	m.notFoundHandler(req, 404, nil)
 }
 
 //endregion
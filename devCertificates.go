@@ -0,0 +1,343 @@
+/*
+ * (C) Copyright 2024 Johan Michel PIQUET, France (https://johanpiquet.fr/).
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpServer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// DevCertificatesParams allows generating https certificates for local development.
+// Browsers and Fetch accept them once the CA certificate is trusted.
+type DevCertificatesParams struct {
+	// Hostnames are the names (or IP) the certificates are created for.
+	// Default is "localhost", which also includes 127.0.0.1 and ::1.
+	Hostnames []string `json:"hostnames"`
+
+	// CacheDir allows keeping the CA and the certificates between two runs.
+	// Without it, they are only created in memory.
+	CacheDir string `json:"cacheDir"`
+
+	// ExportCaFile is where to save the CA certificate (PEM), for example to import it in a browser.
+	ExportCaFile string `json:"exportCaFile"`
+}
+
+// DevCertificateAuthority is a local root CA signing the development certificates.
+type DevCertificateAuthority struct {
+	cert    *x509.Certificate
+	certPem []byte
+	key     *ecdsa.PrivateKey
+}
+
+const gDevCaFileName = "progpjs-dev-ca.pem"
+const gDevCaKeyFileName = "progpjs-dev-ca-key.pem"
+
+// gDevCertificateMinValidity is the time a cached certificate must
+// still be valid for, else a new one is created.
+const gDevCertificateMinValidity = time.Hour * 24
+
+// NewDevCertificateAuthority creates the root CA, or loads it from the cache dir if it exists there.
+// An empty cache dir means the CA is only kept in memory.
+func NewDevCertificateAuthority(cacheDir string) (*DevCertificateAuthority, error) {
+	if cacheDir != "" {
+		cacheDir = toAbsolutePath(cacheDir)
+		m, err := loadDevCertificateAuthority(cacheDir)
+
+		if err == nil {
+			return m, nil
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          newCertificateSerialNumber(),
+		Subject:               pkix.Name{CommonName: "ProgpJS development CA", Organization: []string{"ProgpJS development"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &DevCertificateAuthority{
+		cert:    cert,
+		certPem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		key:     key,
+	}
+
+	if cacheDir != "" {
+		keyPem, err := encodeEcKeyPem(key)
+		if err != nil {
+			return nil, err
+		}
+
+		err = writeCacheFiles(path.Join(cacheDir, gDevCaFileName), m.certPem, path.Join(cacheDir, gDevCaKeyFileName), keyPem)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+func loadDevCertificateAuthority(cacheDir string) (*DevCertificateAuthority, error) {
+	pair, err := tls.LoadX509KeyPair(path.Join(cacheDir, gDevCaFileName), path.Join(cacheDir, gDevCaKeyFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+	if !ok || !cert.IsCA || time.Now().Add(gDevCertificateMinValidity).After(cert.NotAfter) {
+		return nil, errors.New("invalid dev CA")
+	}
+
+	return &DevCertificateAuthority{
+		cert:    cert,
+		certPem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}),
+		key:     key,
+	}, nil
+}
+
+// GetCaPem returns the CA certificate encoded as PEM.
+func (m *DevCertificateAuthority) GetCaPem() []byte {
+	return m.certPem
+}
+
+// GetCertPool returns a pool containing the CA certificate.
+// Allows a client to trust the development certificates.
+func (m *DevCertificateAuthority) GetCertPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(m.cert)
+	return pool
+}
+
+// ExportCa saves the CA certificate as a PEM file.
+func (m *DevCertificateAuthority) ExportCa(filePath string) error {
+	filePath = toAbsolutePath(filePath)
+	_ = os.MkdirAll(path.Dir(filePath), os.ModePerm)
+
+	return os.WriteFile(filePath, m.certPem, 0644)
+}
+
+// CreateCertificate creates a certificate for the hostname, signed by the CA.
+// If a cache dir is given, the certificate is saved there and reused while valid.
+func (m *DevCertificateAuthority) CreateCertificate(hostname string, cacheDir string) (*tls.Certificate, error) {
+	var certFilePath, keyFilePath string
+
+	if cacheDir != "" {
+		cacheDir = toAbsolutePath(cacheDir)
+		fileName := strings.ReplaceAll(strings.ReplaceAll(hostname, "*", "_wildcard"), ":", "_")
+		certFilePath = path.Join(cacheDir, fileName+".pem")
+		keyFilePath = path.Join(cacheDir, fileName+"-key.pem")
+
+		cert, err := m.loadCertificate(certFilePath, keyFilePath)
+		if err == nil {
+			return cert, nil
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: newCertificateSerialNumber(),
+		Subject:      pkix.Name{CommonName: hostname, Organization: []string{"ProgpJS development"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+
+		// Browsers refuse certificates valid for more than 398 days.
+		NotAfter: time.Now().AddDate(0, 0, 397),
+
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	if ip := net.ParseIP(hostname); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{hostname}
+
+		if hostname == "localhost" {
+			template.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, m.cert, &key.PublicKey, m.key)
+	if err != nil {
+		return nil, err
+	}
+
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	keyPem, err := encodeEcKeyPem(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if cacheDir != "" {
+		err = writeCacheFiles(certFilePath, certPem, keyFilePath, keyPem)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cert, err := tls.X509KeyPair(certPem, keyPem)
+	if err != nil {
+		return nil, err
+	}
+
+	cert.Leaf, err = x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cert, nil
+}
+
+// loadCertificate loads a cached certificate, which must be signed by this CA and still valid.
+func (m *DevCertificateAuthority) loadCertificate(certFilePath string, keyFilePath string) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certFilePath, keyFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = cert.Leaf.Verify(x509.VerifyOptions{
+		Roots:       m.GetCertPool(),
+		CurrentTime: time.Now().Add(gDevCertificateMinValidity),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &cert, nil
+}
+
+// AddDevCertificates creates the development CA and adds a certificate for each hostname.
+func (m *CertificateStore) AddDevCertificates(params DevCertificatesParams) (*DevCertificateAuthority, error) {
+	ca, err := NewDevCertificateAuthority(params.CacheDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.ExportCaFile != "" {
+		err = ca.ExportCa(params.ExportCaFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	hostnames := params.Hostnames
+	if len(hostnames) == 0 {
+		hostnames = []string{"localhost"}
+	}
+
+	for _, hostname := range hostnames {
+		cert, err := ca.CreateCertificate(hostname, params.CacheDir)
+		if err != nil {
+			return nil, err
+		}
+
+		err = m.AddCertificate(hostname, cert)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	m.mutex.Lock()
+	m.devCertificateAuthority = ca
+	m.mutex.Unlock()
+
+	return ca, nil
+}
+
+// GetDevCertificateAuthority returns the CA of the development certificates, or nil if none.
+func (m *CertificateStore) GetDevCertificateAuthority() *DevCertificateAuthority {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.devCertificateAuthority
+}
+
+func newCertificateSerialNumber() *big.Int {
+	limit := new(big.Int).Lsh(big.NewInt(1), 128)
+	serial, err := rand.Int(rand.Reader, limit)
+
+	if err != nil {
+		return big.NewInt(time.Now().UnixNano())
+	}
+
+	return serial
+}
+
+func encodeEcKeyPem(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+func writeCacheFiles(certFilePath string, certPem []byte, keyFilePath string, keyPem []byte) error {
+	_ = os.MkdirAll(path.Dir(certFilePath), os.ModePerm)
+
+	err := os.WriteFile(certFilePath, certPem, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(keyFilePath, keyPem, 0600)
+}
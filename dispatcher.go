@@ -0,0 +1,729 @@
+/*
+ * (C) Copyright 2024 Johan Michel PIQUET, France (https://johanpiquet.fr/).
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpServer
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HttpDispatcher contains what is common to the server implementations:
+// the hosts, their https configuration, and calling the handlers of a request.
+type HttpDispatcher struct {
+	server HttpServer
+
+	// hosts contains the hosts and their aliases by name, without the port.
+	hosts map[string]hostEntry
+
+	// wildcardHosts contains the hosts like "*.example.com",
+	// sorted in order to test the longest suffix first.
+	wildcardHosts []wildcardHost
+
+	defaultHost        hostEntry
+	unknownHostHandler UnknownHostHandler
+	panicHandler       PanicHandler
+	hostsMutex         sync.RWMutex
+
+	requestHooks atomic.Pointer[HttpRequestHooks]
+
+	isHttpsEnabled bool
+	httpsPort      int
+
+	// certificates is the store used with https, which knows the hosts asking a client certificate.
+	certificates *CertificateStore
+
+	logger      *log.Logger
+	hideErrors  bool
+	loggerMutex sync.RWMutex
+}
+
+// HttpRoutableRequest is implemented by the requests of the server implementations.
+// It allows the dispatcher to set the host and the route matching the request.
+type HttpRoutableRequest interface {
+	HttpRequest
+
+	SetHost(host *HttpHost)
+	SetResolvedUrl(resolvedUrl UrlResolverResult)
+	GetResolvedUrl() UrlResolverResult
+
+	// IsTLS returns true if the request is received with https.
+	IsTLS() bool
+
+	// GetTLSServerName returns the host name sent by the client during the TLS handshake (SNI).
+	GetTLSServerName() string
+
+	// GetOriginalPathAndQuery returns the path as sent by the client, before being normalized,
+	// followed by the query string. Unlike the raw request target, it never contains the scheme
+	// and the host, which are sent with an absolute-form request like "GET http://example.com/docs".
+	GetOriginalPathAndQuery() string
+
+	// CloseConnection closes the connection without sending a response.
+	CloseConnection()
+
+	// GetStatusCode returns the status of the response, which is 200 if not set.
+	GetStatusCode() int
+
+	// GetBytesSent returns the size of the body sent.
+	GetBytesSent() int64
+
+	// GetAbortReason returns why the connection has been closed without sending a complete response,
+	// or nil if the response is sent.
+	GetAbortReason() error
+}
+
+// UnknownHostHandler is called when no host matches the request.
+// The host name is the value of the "Host" header.
+type UnknownHostHandler func(req HttpRequest, hostName string)
+
+// hostEntry is what a host name is bound to.
+type hostEntry struct {
+	host *HttpHost
+
+	// isRedirect is true for an alias redirecting to the name of the host.
+	isRedirect bool
+}
+
+type wildcardHost struct {
+	// suffix is ".example.com" for "*.example.com".
+	suffix string
+	entry  hostEntry
+}
+
+func NewHttpDispatcher(server HttpServer) *HttpDispatcher {
+	return &HttpDispatcher{
+		server: server,
+		hosts:  make(map[string]hostEntry),
+	}
+}
+
+// GetHost returns the host with this name, creating it if needed.
+// The name can be a wildcard like "*.example.com", matching all the sub-domains,
+// or "*" which is the default host. The port is ignored and the case doesn't matter.
+// For an alias, the host the alias is bound to is returned.
+func (m *HttpDispatcher) GetHost(hostName string) *HttpHost {
+	m.hostsMutex.Lock()
+	defer m.hostsMutex.Unlock()
+
+	hostName = normalizeHostName(hostName)
+
+	entry := m.getEntry(hostName)
+	if entry.host != nil {
+		return entry.host
+	}
+
+	host := NewHttpHost(hostName, m.server, nil)
+	m.setEntry(hostName, hostEntry{host: host})
+
+	return host
+}
+
+// AddHostAlias allows the host to also answer to another name, sharing his routes.
+// If redirectToHost is true, the requests for the alias are redirected to the name of the host.
+// The alias can be a wildcard like "*.example.com", or "*" for the default host.
+func (m *HttpDispatcher) AddHostAlias(alias string, host *HttpHost, redirectToHost bool) error {
+	m.hostsMutex.Lock()
+	defer m.hostsMutex.Unlock()
+
+	alias = normalizeHostName(alias)
+
+	if alias == host.GetHostName() {
+		return errors.New("the alias " + alias + " is the name of the host")
+	}
+
+	if redirectToHost && strings.Contains(host.GetHostName(), "*") {
+		return errors.New("can't redirect to the wildcard host " + host.GetHostName())
+	}
+
+	current := m.getEntry(alias)
+
+	if current.host == host {
+		if current.isRedirect == redirectToHost {
+			return nil
+		}
+	} else if current.host != nil {
+		return errors.New("the name " + alias + " is already used by the host " + current.host.GetHostName())
+	}
+
+	m.setEntry(alias, hostEntry{host: host, isRedirect: redirectToHost})
+	host.addAlias(HttpHostAlias{Name: alias, RedirectToHost: redirectToHost})
+
+	return nil
+}
+
+// getEntry returns what the host name is bound to. The name must be normalized.
+func (m *HttpDispatcher) getEntry(hostName string) hostEntry {
+	if hostName == "*" {
+		return m.defaultHost
+	}
+
+	if strings.HasPrefix(hostName, "*.") {
+		suffix := hostName[1:]
+
+		for _, wildcard := range m.wildcardHosts {
+			if wildcard.suffix == suffix {
+				return wildcard.entry
+			}
+		}
+
+		return hostEntry{}
+	}
+
+	return m.hosts[hostName]
+}
+
+// setEntry binds the host name. The name must be normalized.
+func (m *HttpDispatcher) setEntry(hostName string, entry hostEntry) {
+	if hostName == "*" {
+		m.defaultHost = entry
+		return
+	}
+
+	if strings.HasPrefix(hostName, "*.") {
+		suffix := hostName[1:]
+
+		for i, wildcard := range m.wildcardHosts {
+			if wildcard.suffix == suffix {
+				m.wildcardHosts[i].entry = entry
+				return
+			}
+		}
+
+		m.wildcardHosts = append(m.wildcardHosts, wildcardHost{suffix: suffix, entry: entry})
+
+		sort.SliceStable(m.wildcardHosts, func(i, j int) bool {
+			return len(m.wildcardHosts[i].suffix) > len(m.wildcardHosts[j].suffix)
+		})
+
+		return
+	}
+
+	m.hosts[hostName] = entry
+}
+
+// SetDefaultHost sets the host receiving the requests for which no host matches,
+// for example when the server is requested with his IP. Nil removes the default host.
+func (m *HttpDispatcher) SetDefaultHost(host *HttpHost) {
+	m.hostsMutex.Lock()
+	defer m.hostsMutex.Unlock()
+
+	m.defaultHost = hostEntry{host: host}
+}
+
+// SetUnknownHostHandler sets what to do when no host matches the request and there is
+// no default host. See UnknownHostNotFound, UnknownHostMisdirected, UnknownHostRedirect
+// and UnknownHostClose. Default is UnknownHostNotFound.
+func (m *HttpDispatcher) SetUnknownHostHandler(handler UnknownHostHandler) {
+	m.hostsMutex.Lock()
+	defer m.hostsMutex.Unlock()
+
+	m.unknownHostHandler = handler
+}
+
+// FindHost returns the host to which the request is sent, or nil if none.
+// The host name is the value of the "Host" header. An exact name is searched first,
+// then the wildcard names from the most specific, and at last the default host.
+func (m *HttpDispatcher) FindHost(hostName string) *HttpHost {
+	return m.findEntry(hostName).host
+}
+
+func (m *HttpDispatcher) findEntry(hostName string) hostEntry {
+	hostName = normalizeHostName(hostName)
+
+	m.hostsMutex.RLock()
+	defer m.hostsMutex.RUnlock()
+
+	entry, ok := m.hosts[hostName]
+	if ok {
+		return entry
+	}
+
+	for _, wildcard := range m.wildcardHosts {
+		if (len(hostName) > len(wildcard.suffix)) && strings.HasSuffix(hostName, wildcard.suffix) {
+			return wildcard.entry
+		}
+	}
+
+	return m.defaultHost
+}
+
+// normalizeHostName removes the port, the final dot and the IPv6 brackets, and lower the case.
+func normalizeHostName(hostName string) string {
+	hostName = removePort(hostName)
+	hostName = strings.TrimSuffix(hostName, ".")
+
+	if strings.HasPrefix(hostName, "[") && strings.HasSuffix(hostName, "]") {
+		hostName = hostName[1 : len(hostName)-1]
+	}
+
+	return strings.ToLower(hostName)
+}
+
+// GetLogger returns the logger where the errors are written.
+// Default is the standard logger, or a logger discarding everything if StartParams.HideErrors is set.
+func (m *HttpDispatcher) GetLogger() *log.Logger {
+	m.loggerMutex.RLock()
+	defer m.loggerMutex.RUnlock()
+
+	if m.logger != nil {
+		return m.logger
+	}
+
+	if m.hideErrors {
+		return gDiscardLogger
+	}
+
+	return log.Default()
+}
+
+// SetLogger sets the logger where the errors are written. Nil restores the default logger.
+func (m *HttpDispatcher) SetLogger(logger *log.Logger) {
+	m.loggerMutex.Lock()
+	defer m.loggerMutex.Unlock()
+
+	m.logger = logger
+}
+
+// Configure is called when the server starts. If https is enabled, it configures
+// the hosts having a certificate and returns the store containing the certificates.
+func (m *HttpDispatcher) Configure(params *StartParams) (*CertificateStore, error) {
+	m.isHttpsEnabled = params.IsHttpsEnabled()
+	m.httpsPort = params.HttpsPort
+
+	m.loggerMutex.Lock()
+	m.hideErrors = params.HideErrors
+	m.loggerMutex.Unlock()
+
+	if !m.isHttpsEnabled {
+		return nil, nil
+	}
+
+	certificates := NewCertificateStore()
+	certificates.getLogger = m.GetLogger
+	m.certificates = certificates
+
+	err := certificates.SetClientAuth(params.ClientAuthMode, params.ClientCaFile)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, httpsInfo := range params.Certificates {
+		// The http-01 challenge is answered by the plain http listener, which only exists with a https port.
+		if httpsInfo.UseLetsEncrypt && (httpsInfo.AcmeChallengeType == AcmeChallengeHttp) && (params.HttpsPort == 0) {
+			return nil, errors.New("the ACME http-01 challenge of " + httpsInfo.Hostname + " requires StartParams.HttpsPort")
+		}
+
+		host := m.GetHost(httpsInfo.Hostname)
+		host.AllowHttps()
+
+		if httpsInfo.ForceHttps {
+			host.ForceHttps()
+		}
+
+		if httpsInfo.HstsMaxAgeInSec > 0 {
+			host.SetHsts(httpsInfo.HstsMaxAgeInSec, httpsInfo.HstsIncludeSubDomains, false)
+		}
+
+		err := certificates.Add(httpsInfo)
+		if err != nil {
+			return nil, err
+		}
+
+		acmeMiddleware := certificates.GetAcmeHttpMiddleware(httpsInfo.Hostname)
+		if acmeMiddleware != nil {
+			host.GET(AcmeChallengePath+"*", acmeMiddleware)
+		}
+	}
+
+	// Development certificates are signed by a local CA, created in memory
+	// or in a cache dir. Trusting this CA avoids the browser warnings.
+	if params.DevCertificates != nil {
+		_, err = certificates.AddDevCertificates(*params.DevCertificates)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if certificates.IsEmpty() {
+		return nil, errors.New("https is enabled but no certificate is provided")
+	}
+
+	return certificates, nil
+}
+
+// Dispatch finds the host and the route of the request, then calls the middlewares and the handler.
+// The host name is the value of the "Host" header.
+// A panic is recovered and sent to the host error handler as a PanicError.
+func (m *HttpDispatcher) Dispatch(req HttpRoutableRequest, hostName string) {
+	startTime := time.Now()
+	hooks := m.requestHooks.Load()
+
+	if (hooks != nil) && (hooks.OnRequestStart != nil) {
+		m.callHook("OnRequestStart", func() { hooks.OnRequestStart(req) })
+	}
+
+	entry := m.findEntry(hostName)
+
+	// Called after the panic is recovered, once the response is sent.
+	defer m.endRequest(req, entry.host, hooks, startTime)
+
+	m.dispatch(req, hostName, entry)
+}
+
+func (m *HttpDispatcher) dispatch(req HttpRoutableRequest, hostName string, entry hostEntry) {
+	var resolvedUrl UrlResolverResult
+	defer m.recoverPanic(req, resolvedUrl.GetPattern)
+
+	isTls := req.IsTLS()
+	host := entry.host
+
+	if host == nil {
+		m.hostsMutex.RLock()
+		handler := m.unknownHostHandler
+		m.hostsMutex.RUnlock()
+
+		if handler == nil {
+			handler = UnknownHostNotFound
+		}
+
+		handler(req, hostName)
+		return
+	}
+
+	if isTls && m.isClientAuthBypassed(req, hostName, host) {
+		UnknownHostMisdirected(req, hostName)
+		return
+	}
+	//
+	req.SetHost(host)
+
+	if entry.isRedirect {
+		m.redirectToHostName(req, hostName, host.GetHostName())
+		return
+	}
+
+	rPath := req.Path()
+
+	if isTls {
+		hsts := host.GetHstsHeader()
+
+		if hsts != "" {
+			req.SetHeader("Strict-Transport-Security", hsts)
+		}
+	} else if host.IsHttpsForced() && m.isHttpsEnabled && (m.httpsPort != 0) &&
+		!strings.HasPrefix(rPath, AcmeChallengePath) {
+		// The ACME http-01 challenge must be answered with http.
+		m.redirectToHttps(req, hostName)
+		return
+	}
+
+	if err := callMiddlewares(req, host.GetMiddlewares()); err != nil {
+		host.OnError(req, err)
+		return
+	}
+
+	if req.MustStop() || req.IsBodySend() {
+		return
+	}
+
+	var isFound bool
+
+	resolvedUrl, isFound = resolveRoute(req, host)
+	if !isFound {
+		return
+	}
+
+	err := callRoute(req, resolvedUrl, m.requestHooks.Load(), "")
+	if err != nil {
+		host.OnError(req, err)
+	}
+}
+
+// resolveRoute searches the route of the request in the routes of the host, following his routing policy.
+// Returns false if the request is already answered, because of a redirection or because there is no route.
+func resolveRoute(req HttpRoutableRequest, host *HttpHost) (UrlResolverResult, bool) {
+	// The middlewares can change the path.
+	rPath := req.Path()
+	policy := host.GetRoutingPolicy()
+
+	// The same routes are used for the whole request, even if they are replaced meanwhile.
+	routes := host.routes.Load()
+
+	if policy.TrailingSlash == TrailingSlashRedirect {
+		rawPath, query := splitRequestURI(req.GetOriginalPathAndQuery())
+
+		// The path is already collapsed, but the client must use the canonical url.
+		if strings.Contains(rawPath, "//") {
+			redirectPermanently(req, collapseSlashes(rawPath)+query)
+			return UrlResolverResult{}, false
+		}
+	}
+
+	resolvedUrl, isToggled := routes.findWithPolicy(req.GetMethodCode(), rPath, &policy)
+
+	if resolvedUrl.Target == nil {
+		onRouteNotFound(req, routes, rPath, &policy)
+		return resolvedUrl, false
+	}
+
+	if isToggled && (policy.TrailingSlash == TrailingSlashRedirect) {
+		rawPath, query := splitRequestURI(req.GetOriginalPathAndQuery())
+		redirectPermanently(req, toggleTrailingSlash(rawPath)+query)
+		return UrlResolverResult{}, false
+	}
+
+	return resolvedUrl, true
+}
+
+// findWithPolicy returns the route for the method and the path, following the routing policy.
+// isToggled is true when the route has been found by adding or removing the trailing slash.
+func (m *httpRouteTable) findWithPolicy(methodCode HttpMethod, rPath string, policy *HttpRoutingPolicy) (resolvedUrl UrlResolverResult, isToggled bool) {
+	options := policy.getFindOptions()
+	resolvedUrl = findRoute(m, methodCode, rPath, options)
+
+	if (resolvedUrl.Target != nil) || (policy.TrailingSlash == TrailingSlashStrict) || (rPath == "/") {
+		return resolvedUrl, false
+	}
+
+	alternative := findRoute(m, methodCode, toggleTrailingSlash(rPath), options)
+
+	if alternative.Target != nil {
+		return alternative, true
+	}
+
+	if policy.TrailingSlash == TrailingSlashMatchBoth {
+		// Allows "/docs/" to match "/docs/*", once "/docs" has been tested.
+		options.MatchEmptyCatchAll = true
+		resolvedUrl = findRoute(m, methodCode, rPath, options)
+	}
+
+	return resolvedUrl, false
+}
+
+// callRoute calls the middlewares of the route, then his handler.
+// The prefix is added to the pattern given to the OnRouteMatched hook, for the routes of a mounted host.
+func callRoute(req HttpRoutableRequest, resolvedUrl UrlResolverResult, hooks *HttpRequestHooks, prefix string) error {
+	req.SetResolvedUrl(resolvedUrl)
+
+	if (hooks != nil) && (hooks.OnRouteMatched != nil) {
+		hooks.OnRouteMatched(req, prefix+resolvedUrl.GetPattern(), resolvedUrl.GetTag())
+	}
+
+	for _, h := range resolvedUrl.Middlewares {
+		err := h.(HttpMiddleware)(req)
+
+		if (err != nil) || req.MustStop() || req.IsBodySend() {
+			return err
+		}
+	}
+
+	return resolvedUrl.Target.(HttpMiddleware)(req)
+}
+
+// callResponseHooks calls the hooks added with HttpHost.OnResponse.
+// A panic in a hook is logged, since the response is already sent.
+func (m *HttpDispatcher) callResponseHooks(req HttpRoutableRequest, host *HttpHost) {
+	hooks := host.GetResponseHooks()
+	if hooks == nil {
+		return
+	}
+
+	status := req.GetStatusCode()
+
+	m.callHook("OnResponse", func() {
+		for _, hook := range hooks {
+			hook(req, status)
+		}
+	})
+}
+
+// findRoute returns the route for the method and the path.
+// Without HEAD route, the GET route is used. The server doesn't send the body.
+func findRoute(routes *httpRouteTable, methodCode HttpMethod, rPath string, options *UrlResolverFindOptions) UrlResolverResult {
+	resolvedUrl := routes.urlResolvers[methodCode].FindWithOptions(rPath, options)
+
+	if (resolvedUrl.Target == nil) && (methodCode == HttpMethodHEAD) {
+		resolvedUrl = routes.urlResolvers[HttpMethodGET].FindWithOptions(rPath, options)
+	}
+
+	return resolvedUrl
+}
+
+// onRouteNotFound is called when there is no route for the method of the request.
+// If the path exists for other methods, a 405 error is returned, or the allowed methods for OPTIONS.
+// The errors are answered by the host of the request, which isn't the host of the routes for a mounted host.
+func onRouteNotFound(req HttpRoutableRequest, routes *httpRouteTable, rPath string, policy *HttpRoutingPolicy) {
+	host := req.GetHost()
+	allowedMethods := routes.getAllowedMethods(rPath, policy)
+
+	if allowedMethods == nil {
+		host.OnNotFound(req)
+		return
+	}
+
+	allow := strings.Join(allowedMethods, ", ")
+
+	if req.GetMethodCode() == HttpMethodOPTIONS {
+		req.SetHeader("Allow", allow)
+		req.ReturnString(204, "")
+		return
+	}
+
+	host.OnError(req, NewHttpError(405, "").WithHeader("Allow", allow))
+}
+
+// isClientAuthBypassed returns true if the TLS handshake has been done for another host than
+// the host of the request, while this host has his own client certificate verification.
+// Without this check, a client could do the handshake with a host not asking a certificate,
+// then send his requests to a host requiring one.
+func (m *HttpDispatcher) isClientAuthBypassed(req HttpRoutableRequest, hostName string, host *HttpHost) bool {
+	if m.certificates == nil {
+		return false
+	}
+
+	serverName := strings.TrimSuffix(strings.ToLower(req.GetTLSServerName()), ".")
+	requestName := strings.TrimSuffix(strings.ToLower(removePort(hostName)), ".")
+
+	if serverName == requestName {
+		return false
+	}
+
+	return m.certificates.hasHostClientAuth(requestName) || m.certificates.hasHostClientAuth(host.GetHostName())
+}
+
+// redirectToHttps redirects the request to the same url with https.
+func (m *HttpDispatcher) redirectToHttps(req HttpRoutableRequest, hostName string) {
+	redirectPermanently(req, getHttpsOrigin(hostName, m.httpsPort)+req.GetOriginalPathAndQuery())
+}
+
+// getHttpsOrigin returns the https url of the host, with the https port instead of the port of the host name.
+// For example "[::1]:8080" gives "https://[::1]:8443".
+func getHttpsOrigin(hostName string, httpsPort int) string {
+	hostName = strings.TrimSuffix(strings.TrimPrefix(removePort(hostName), "["), "]")
+
+	if httpsPort != 443 {
+		return "https://" + net.JoinHostPort(hostName, strconv.Itoa(httpsPort))
+	}
+
+	if strings.Contains(hostName, ":") {
+		// IPv6
+		hostName = "[" + hostName + "]"
+	}
+
+	return "https://" + hostName
+}
+
+// redirectToHostName redirects the request of an alias to the name of his host,
+// keeping the scheme and the port.
+func (m *HttpDispatcher) redirectToHostName(req HttpRoutableRequest, hostName string, canonicalName string) {
+	target := string(req.URI().UriScheme()) + "://"
+
+	if strings.Contains(canonicalName, ":") {
+		// IPv6
+		canonicalName = "[" + canonicalName + "]"
+	}
+
+	_, port, err := net.SplitHostPort(hostName)
+	if err == nil {
+		target += net.JoinHostPort(canonicalName, port)
+	} else {
+		target += canonicalName
+	}
+
+	redirectPermanently(req, target+req.GetOriginalPathAndQuery())
+}
+
+//region Unknown hosts
+
+// UnknownHostNotFound answers with a 404 to the requests for an unknown host.
+func UnknownHostNotFound(req HttpRequest, hostName string) {
+	req.ReturnString(404, "not found")
+}
+
+// UnknownHostMisdirected answers with a 421, telling the client
+// that this server isn't able to answer for this host.
+func UnknownHostMisdirected(req HttpRequest, hostName string) {
+	req.ReturnString(421, "misdirected request")
+}
+
+// UnknownHostClose closes the connection without answering.
+func UnknownHostClose(req HttpRequest, hostName string) {
+	routable, ok := req.(HttpRoutableRequest)
+
+	if ok {
+		routable.CloseConnection()
+	} else {
+		UnknownHostMisdirected(req, hostName)
+	}
+}
+
+// UnknownHostRedirect returns a handler redirecting the requests for an unknown host
+// to the same path on the target, which is for example "https://www.example.com".
+func UnknownHostRedirect(target string) UnknownHostHandler {
+	target = strings.TrimSuffix(target, "/")
+
+	return func(req HttpRequest, hostName string) {
+		if routable, ok := req.(HttpRoutableRequest); ok {
+			redirectPermanently(req, target+routable.GetOriginalPathAndQuery())
+			return
+		}
+
+		requestUri := string(req.URI().UriPath())
+
+		if query := req.URI().UriQueryString(); len(query) != 0 {
+			requestUri += "?" + string(query)
+		}
+
+		redirectPermanently(req, target+requestUri)
+	}
+}
+
+//endregion
+
+// redirectPermanently redirects the request to the target url.
+// Use a 308 for methods other than GET and HEAD, in order to keep the method and the body.
+func redirectPermanently(req HttpRequest, target string) {
+	req.SetHeader("Location", target)
+
+	methodCode := req.GetMethodCode()
+
+	if (methodCode == HttpMethodGET) || (methodCode == HttpMethodHEAD) {
+		req.ReturnString(301, "")
+	} else {
+		req.ReturnString(308, "")
+	}
+}
+
+var gDiscardLogger = log.New(io.Discard, "", 0)
+
+// removePort removes the port from a host name, for example "localhost:8000" gives "localhost".
+func removePort(hostName string) string {
+	host, _, err := net.SplitHostPort(hostName)
+	if err != nil {
+		// No port.
+		return hostName
+	}
+
+	return host
+}
@@ -0,0 +1,252 @@
+/*
+ * (C) Copyright 2024 Johan Michel PIQUET, France (https://johanpiquet.fr/).
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpServer
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func expectHost(test *testing.T, dispatcher *HttpDispatcher, hostName string, expected *HttpHost) {
+	found := dispatcher.FindHost(hostName)
+
+	if found != expected {
+		foundName := "nil"
+		if found != nil {
+			foundName = found.GetHostName()
+		}
+
+		test.Error("Bad host for [", hostName, "], found [", foundName, "]")
+	}
+}
+
+func TestFindHost(test *testing.T) {
+	dispatcher := NewHttpDispatcher(nil)
+
+	example := dispatcher.GetHost("Example.com:8000")
+	wildcard := dispatcher.GetHost("*.example.com")
+	tenant := dispatcher.GetHost("*.tenant.example.com")
+
+	if dispatcher.GetHost("example.com") != example {
+		test.Error("The port and the case must be ignored by GetHost")
+	}
+
+	expectHost(test, dispatcher, "example.com", example)
+	expectHost(test, dispatcher, "EXAMPLE.COM:8000", example)
+	expectHost(test, dispatcher, "example.com.:443", example)
+	expectHost(test, dispatcher, "www.example.com", wildcard)
+	expectHost(test, dispatcher, "a.b.example.com", wildcard)
+	expectHost(test, dispatcher, "client.tenant.example.com", tenant)
+	expectHost(test, dispatcher, "other.com", nil)
+	expectHost(test, dispatcher, "127.0.0.1:8000", nil)
+
+	defaultHost := dispatcher.GetHost("*")
+	expectHost(test, dispatcher, "other.com", defaultHost)
+	expectHost(test, dispatcher, "[::1]:8000", defaultHost)
+
+	ipHost := dispatcher.GetHost("[::1]")
+	expectHost(test, dispatcher, "[::1]:8000", ipHost)
+
+	dispatcher.SetDefaultHost(nil)
+	expectHost(test, dispatcher, "other.com", nil)
+}
+
+func TestHostAliases(test *testing.T) {
+	dispatcher := NewHttpDispatcher(nil)
+
+	host := dispatcher.GetHost("example.com")
+	other := dispatcher.GetHost("other.com")
+
+	if err := dispatcher.AddHostAlias("WWW.example.com", host, false); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := dispatcher.AddHostAlias("*.example.localhost", host, true); err != nil {
+		test.Fatal(err)
+	}
+
+	expectHost(test, dispatcher, "www.example.com", host)
+	expectHost(test, dispatcher, "my.example.localhost:8000", host)
+
+	if dispatcher.GetHost("www.example.com") != host {
+		test.Error("GetHost must return the host of the alias")
+	}
+
+	aliases := host.GetAliases()
+
+	if (len(aliases) != 2) || (aliases[0] != HttpHostAlias{Name: "www.example.com"}) ||
+		(aliases[1] != HttpHostAlias{Name: "*.example.localhost", RedirectToHost: true}) {
+		test.Error("Invalid aliases", aliases)
+	}
+
+	if dispatcher.AddHostAlias("other.com", host, false) == nil {
+		test.Error("The name of another host can't be an alias")
+	}
+
+	if dispatcher.AddHostAlias("example.com", host, true) == nil {
+		test.Error("The name of the host can't be an alias")
+	}
+
+	if dispatcher.AddHostAlias("other.localhost", dispatcher.GetHost("*.example.net"), true) == nil {
+		test.Error("Redirecting to a wildcard host must fail")
+	}
+
+	expectHost(test, dispatcher, "other.com", other)
+}
+
+func TestHttpsOrigin(test *testing.T) {
+	expectOrigin := func(hostName string, httpsPort int, expected string) {
+		if found := getHttpsOrigin(hostName, httpsPort); found != expected {
+			test.Error("Invalid https origin for [", hostName, "], found [", found, "]")
+		}
+	}
+
+	expectOrigin("example.com", 443, "https://example.com")
+	expectOrigin("example.com:8080", 8443, "https://example.com:8443")
+	expectOrigin("[::1]:8080", 8443, "https://[::1]:8443")
+	expectOrigin("[::1]:8080", 443, "https://[::1]")
+	expectOrigin("[::1]", 8443, "https://[::1]:8443")
+}
+
+func TestReplaceRoutes(test *testing.T) {
+	host := NewHttpDispatcher(nil).GetHost("example.com")
+	handler := func(call HttpRequest) error { return nil }
+
+	host.GET("/old", handler)
+	oldResolver := host.GetUrlResolver(HttpMethodGET)
+
+	host.Use(handler)
+	host.OnResponse(func(call HttpRequest, status int) {})
+
+	err := host.ReplaceRoutes(func(draft *HttpHost) error {
+		draft.GET("/new", handler)
+		draft.POST("/new", handler)
+		return nil
+	})
+
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	resolver := host.GetUrlResolver(HttpMethodGET)
+
+	if (resolver.Find("/new").Target == nil) || (resolver.Find("/old").Target != nil) {
+		test.Error("The new routes must replace the old routes")
+	}
+
+	if (oldResolver.Find("/old").Target == nil) || (oldResolver.Find("/new").Target != nil) {
+		test.Error("The old routes must not be modified")
+	}
+
+	if resolver.DumpTree()[0].Tag != host {
+		test.Error("The routes of the draft must be tagged with the host")
+	}
+
+	_ = host.ReplaceRoutes(func(draft *HttpHost) error {
+		draft.GET("/other", handler)
+		return errors.New("invalid routes")
+	})
+
+	if host.GetUrlResolver(HttpMethodGET) != resolver {
+		test.Error("The routes must not be replaced when the build fails")
+	}
+
+	if !host.RemoveRoute("POST", "/new") || (host.GetUrlResolver(HttpMethodPOST).Find("/new").Target != nil) {
+		test.Error("The route must be removed")
+	}
+
+	host.Reset()
+
+	if host.GetUrlResolver(HttpMethodGET).Find("/new").Target != nil {
+		test.Error("Reset must remove the routes")
+	}
+
+	if (len(host.GetMiddlewares()) != 1) || (len(host.GetResponseHooks()) != 1) {
+		test.Error("The middlewares and the response hooks must be kept by ReplaceRoutes and Reset")
+	}
+
+	_ = host.ReplaceRoutes(func(draft *HttpHost) error {
+		draft.Use(handler)
+		return nil
+	})
+
+	if len(host.GetMiddlewares()) != 2 {
+		test.Error("Use on the draft must add the middleware to the host")
+	}
+}
+
+func TestURLFor(test *testing.T) {
+	host := NewHttpDispatcher(nil).GetHost("example.com")
+	handler := func(call HttpRequest) error { return nil }
+
+	host.NamedRoute("home", "GET", "/", handler)
+	host.NamedRoute("post", "GET", "/users/:id/posts/{slug}", handler)
+	host.NamedRoute("order", "POST", "/orders/{id:int}", handler)
+	host.NamedRoute("file", "GET", "/files/{name:[a-z]+}.{ext}", handler)
+	host.NamedRoute("wildcard", "GET", "/static/*", handler)
+	host.Group("/api/:version").NamedRoute("api-user", "GET", "/users/:id", handler)
+
+	expectUrl := func(name string, params map[string]string, query url.Values, expected string) {
+		found, err := host.URLFor(name, params, query)
+
+		if (err != nil) || (found != expected) {
+			test.Error("Invalid url for [", name, "], found [", found, "] error [", err, "]")
+		}
+	}
+
+	expectError := func(name string, params map[string]string) {
+		if found, err := host.URLFor(name, params, nil); err == nil {
+			test.Error("An error is expected for [", name, "], found [", found, "]")
+		}
+	}
+
+	expectUrl("home", nil, nil, "/")
+	expectUrl("post", map[string]string{"id": "john doe", "slug": "a/b"}, url.Values{"page": {"2"}}, "/users/john%20doe/posts/a%2Fb?page=2")
+	expectUrl("order", map[string]string{"id": "12"}, nil, "/orders/12")
+	expectUrl("file", map[string]string{"name": "report", "ext": "pdf"}, nil, "/files/report.pdf")
+	expectUrl("api-user", map[string]string{"version": "v1", "id": "3"}, nil, "/api/v1/users/3")
+
+	expectError("unknown", nil)
+	expectError("post", map[string]string{"id": "john"})
+	expectError("post", map[string]string{"id": "john", "slug": "a", "other": "b"})
+	expectError("post", map[string]string{"id": "", "slug": "a"})
+	expectError("order", map[string]string{"id": "abc"})
+	expectError("file", map[string]string{"name": "Report", "ext": "pdf"})
+	expectError("wildcard", nil)
+
+	if host.NamedRoute("post", "POST", "/users/:id/posts/{slug}", handler) == nil {
+		test.Error("A route name used by another method must be refused")
+	}
+
+	if host.NamedRoute("post", "GET", "/posts/{slug}", handler) == nil {
+		test.Error("A route name used by another path must be refused")
+	}
+
+	if host.NamedRoute("post", "GET", "/users/:id/posts/{slug}", handler) != nil {
+		test.Error("Replacing the handler of a named route must be allowed")
+	}
+
+	expectUrl("post", map[string]string{"id": "1", "slug": "a"}, nil, "/users/1/posts/a")
+
+	host.RemoveRoute("POST", "/orders/{id:int}")
+	expectError("order", map[string]string{"id": "12"})
+
+	if host.NamedRoute("order", "PUT", "/orders/{id:int}", handler) != nil {
+		test.Error("The name of a removed route must be reusable")
+	}
+}
@@ -0,0 +1,159 @@
+/*
+ * (C) Copyright 2024 Johan Michel PIQUET, France (https://johanpiquet.fr/).
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpServer
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// HttpErrorHandler writes the response of a request in error.
+// The status is the one of the HttpError returned by the middleware, or 500 for other errors,
+// and 404 when no route matches the request, in which case err is nil.
+type HttpErrorHandler func(req HttpRequest, status int, err error)
+
+// HttpErrorPageData is what the templates of NewTemplateErrorHandler receive.
+type HttpErrorPageData struct {
+	Status     int
+	StatusText string
+
+	// Message is the message which can be shown to the user, which is the public message of an HttpError.
+	// The text of other errors isn't used, since he can contain private information.
+	Message string
+
+	Path string
+}
+
+func newHttpErrorPageData(req HttpRequest, status int, err error) HttpErrorPageData {
+	statusText := http.StatusText(status)
+	message := statusText
+
+	if httpError := AsHttpError(err); httpError != nil {
+		message = httpError.GetPublicMessage()
+	}
+
+	return HttpErrorPageData{
+		Status:     status,
+		StatusText: statusText,
+		Message:    message,
+		Path:       req.Path(),
+	}
+}
+
+// DefaultErrorHandler writes "error" or "not found" as plain text,
+// or the public message of an HttpError.
+func DefaultErrorHandler(req HttpRequest, status int, err error) {
+	if httpError := AsHttpError(err); httpError != nil {
+		req.ReturnString(status, httpError.GetPublicMessage())
+	} else if status == 404 {
+		req.ReturnString(404, "not found")
+	} else {
+		req.ReturnString(status, "error")
+	}
+}
+
+// NewTemplateErrorHandler returns a handler rendering the HTML template with a HttpErrorPageData.
+func NewTemplateErrorHandler(tpl *template.Template) HttpErrorHandler {
+	return func(req HttpRequest, status int, err error) {
+		var buffer bytes.Buffer
+
+		renderErr := tpl.Execute(&buffer, newHttpErrorPageData(req, status, err))
+		if renderErr != nil {
+			DefaultErrorHandler(req, status, err)
+			return
+		}
+
+		req.SetContentType("text/html; charset=utf-8")
+		req.ReturnString(status, buffer.String())
+	}
+}
+
+// NewProblemDetailsErrorHandler returns a handler writing a JSON problem details (RFC 9457)
+// when the client accepts JSON. Otherwise, the fallback handler is used, or DefaultErrorHandler if nil.
+func NewProblemDetailsErrorHandler(fallback HttpErrorHandler) HttpErrorHandler {
+	if fallback == nil {
+		fallback = DefaultErrorHandler
+	}
+
+	return func(req HttpRequest, status int, err error) {
+		if !isJsonAccepted(req) {
+			fallback(req, status, err)
+			return
+		}
+
+		data := newHttpErrorPageData(req, status, err)
+
+		problem := map[string]any{
+			"type":     "about:blank",
+			"title":    data.StatusText,
+			"status":   status,
+			"detail":   data.Message,
+			"instance": data.Path,
+		}
+
+		asJson, jsonErr := json.Marshal(problem)
+		if jsonErr != nil {
+			fallback(req, status, err)
+			return
+		}
+
+		req.SetContentType("application/problem+json")
+		req.ReturnString(status, string(asJson))
+	}
+}
+
+// isJsonAccepted returns true if the "Accept" header of the request contains a JSON type.
+func isJsonAccepted(req HttpRequest) bool {
+	accept := req.GetHeaders()["Accept"]
+
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, _, _ := strings.Cut(mediaRange, ";")
+		mediaType = strings.TrimSpace(mediaType)
+
+		if (mediaType == "application/json") || (mediaType == "application/problem+json") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NewFileErrorHandler returns a handler sending the content of the file, with the status of the error.
+// The file is read once, when calling this function.
+func NewFileErrorHandler(filePath string) (HttpErrorHandler, error) {
+	content, err := os.ReadFile(toAbsolutePath(filePath))
+	if err != nil {
+		return nil, err
+	}
+
+	text := string(content)
+	contentType := mime.TypeByExtension(path.Ext(filePath))
+
+	return func(req HttpRequest, status int, err error) {
+		if contentType != "" {
+			req.SetContentType(contentType)
+		}
+
+		req.ReturnString(status, text)
+	}, nil
+}
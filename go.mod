@@ -2,10 +2,15 @@ module github.com/progpjs/httpServer/v2
 
 go 1.20
 
-require github.com/valyala/fasthttp v1.52.0
+require (
+	github.com/valyala/fasthttp v1.52.0
+	golang.org/x/crypto v0.19.0
+	golang.org/x/net v0.21.0
+)
 
 require (
 	github.com/andybalholm/brotli v1.1.0 // indirect
 	github.com/klauspost/compress v1.17.6 // indirect
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
 )
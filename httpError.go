@@ -0,0 +1,140 @@
+/*
+ * (C) Copyright 2024 Johan Michel PIQUET, France (https://johanpiquet.fr/).
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpServer
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// HttpError is an error which can be returned by a middleware in order to
+// send a response with a specific status, instead of a 500 error.
+type HttpError struct {
+	// Status is the http status code of the response.
+	Status int
+
+	// Message is the message which can be shown to the user.
+	// If empty, the status text is used.
+	Message string
+
+	// Headers are added to the response.
+	Headers map[string]string
+
+	// Cause is the private error, which is logged but never sent to the user.
+	Cause error
+}
+
+// NewHttpError returns an error sending a response with this status and this public message.
+func NewHttpError(status int, message string) *HttpError {
+	return &HttpError{Status: status, Message: message}
+}
+
+func NewBadRequestError(message string) *HttpError {
+	return NewHttpError(http.StatusBadRequest, message)
+}
+
+func NewUnauthorizedError(message string) *HttpError {
+	return NewHttpError(http.StatusUnauthorized, message)
+}
+
+func NewForbiddenError(message string) *HttpError {
+	return NewHttpError(http.StatusForbidden, message)
+}
+
+func NewNotFoundError(message string) *HttpError {
+	return NewHttpError(http.StatusNotFound, message)
+}
+
+func NewConflictError(message string) *HttpError {
+	return NewHttpError(http.StatusConflict, message)
+}
+
+func NewUnprocessableEntityError(message string) *HttpError {
+	return NewHttpError(http.StatusUnprocessableEntity, message)
+}
+
+func NewTooManyRequestsError(message string) *HttpError {
+	return NewHttpError(http.StatusTooManyRequests, message)
+}
+
+// NewInternalServerError returns a 500 error wrapping the cause.
+func NewInternalServerError(cause error) *HttpError {
+	return &HttpError{Status: http.StatusInternalServerError, Cause: cause}
+}
+
+// WithHeader allows adding a header to the response, for example "WWW-Authenticate" with a 401.
+func (m *HttpError) WithHeader(key, value string) *HttpError {
+	if m.Headers == nil {
+		m.Headers = make(map[string]string)
+	}
+
+	m.Headers[key] = value
+	return m
+}
+
+// WithCause allows wrapping the private error which is the cause of this error.
+func (m *HttpError) WithCause(cause error) *HttpError {
+	m.Cause = cause
+	return m
+}
+
+// GetPublicMessage returns the message which can be shown to the user.
+func (m *HttpError) GetPublicMessage() string {
+	if m.Message != "" {
+		return m.Message
+	}
+
+	return http.StatusText(m.Status)
+}
+
+func (m *HttpError) Error() string {
+	res := strconv.Itoa(m.Status) + " " + m.GetPublicMessage()
+
+	if m.Cause != nil {
+		res += ": " + m.Cause.Error()
+	}
+
+	return res
+}
+
+func (m *HttpError) Unwrap() error {
+	return m.Cause
+}
+
+// AsHttpError returns the HttpError found in the chain of this error, or nil.
+func AsHttpError(err error) *HttpError {
+	var httpError *HttpError
+
+	if (err == nil) || !errors.As(err, &httpError) {
+		return nil
+	}
+
+	return httpError
+}
+
+// getErrorStatus returns the status to send for this error.
+// It's 500 if it isn't an HttpError, or if the status isn't an error status.
+func getErrorStatus(err error) int {
+	httpError := AsHttpError(err)
+
+	if (httpError == nil) || (httpError.Status < 400) || (httpError.Status > 599) {
+		return http.StatusInternalServerError
+	}
+
+	return httpError.Status
+}
@@ -25,6 +25,7 @@ type fastHttpRequest struct {
 
 	mustStop   bool
 	isBodySend bool
+	isClosed   bool
 
 	unlockMutex_ sync.Mutex
 	cookie       fastHttpCookie
@@ -60,6 +61,10 @@ func (m *fastHttpRequest) GetContentLength() int {
 	return m.fastRequestHeader.ContentLength()
 }
 
+func (m *fastHttpRequest) IsHead() bool {
+	return m.methodCode == httpServer.HttpMethodHEAD
+}
+
 func (m *fastHttpRequest) IsBodySend() bool {
 	return m.isBodySend
 }
@@ -185,6 +190,10 @@ func (m *fastHttpRequest) Path() string {
 	return m.path
 }
 
+func (m *fastHttpRequest) SetPath(path string) {
+	m.path = path
+}
+
 func (m *fastHttpRequest) UserAgent() string {
 	return UnsafeString(m.fast.UserAgent())
 }
@@ -200,6 +209,10 @@ func (m *fastHttpRequest) RemoteIP() string {
 	}
 }
 
+func (m *fastHttpRequest) GetClientCertificate() *httpServer.HttpClientCertificate {
+	return httpServer.NewHttpClientCertificate(m.fast.TLSConnectionState())
+}
+
 func (m *fastHttpRequest) URI() httpServer.UriReader {
 	return m
 }
@@ -232,12 +245,13 @@ func (m *fastHttpRequest) UriQueryString() []byte {
 	return m.uri.QueryString()
 }
 
+// UriScheme returns the scheme the request has been received with, which is "https" or "http".
 func (m *fastHttpRequest) UriScheme() []byte {
-	if m.uri == nil {
-		m.uri = m.fast.Request.URI()
+	if m.fast.IsTLS() {
+		return gSchemeHttps
 	}
 
-	return m.uri.Scheme()
+	return gSchemeHttp
 }
 
 func (m *fastHttpRequest) UriHost() []byte {
@@ -252,6 +266,93 @@ func (m *fastHttpRequest) GetHost() *httpServer.HttpHost {
 	return m.host
 }
 
+func (m *fastHttpRequest) SetHost(host *httpServer.HttpHost) {
+	m.host = host
+}
+
+func (m *fastHttpRequest) SetResolvedUrl(resolvedUrl httpServer.UrlResolverResult) {
+	m.resolvedUrl = resolvedUrl
+}
+
+func (m *fastHttpRequest) GetResolvedUrl() httpServer.UrlResolverResult {
+	return m.resolvedUrl
+}
+
+func (m *fastHttpRequest) IsTLS() bool {
+	return m.fast.IsTLS()
+}
+
+func (m *fastHttpRequest) GetTLSServerName() string {
+	state := m.fast.TLSConnectionState()
+	if state == nil {
+		return ""
+	}
+
+	return state.ServerName
+}
+
+func (m *fastHttpRequest) GetOriginalPathAndQuery() string {
+	if m.uri == nil {
+		m.uri = m.fast.Request.URI()
+	}
+
+	res := string(m.uri.PathOriginal())
+	if res == "" {
+		res = "/"
+	}
+
+	if query := m.uri.QueryString(); len(query) != 0 {
+		res += "?" + string(query)
+	}
+
+	return res
+}
+
+func (m *fastHttpRequest) GetStatusCode() int {
+	return m.fastResponse.StatusCode()
+}
+
+func (m *fastHttpRequest) GetBytesSent() int64 {
+	if m.isClosed || m.IsHead() {
+		return 0
+	}
+
+	if m.fastResponse.IsBodyStream() {
+		// Is -1 if the size isn't known.
+		contentLength := m.fastResponse.Header.ContentLength()
+		if contentLength < 0 {
+			return 0
+		}
+
+		return int64(contentLength)
+	}
+
+	return int64(len(m.fastResponse.Body()))
+}
+
+func (m *fastHttpRequest) GetAbortReason() error {
+	if m.isClosed {
+		return httpServer.ErrConnectionClosed
+	}
+
+	return nil
+}
+
+func (m *fastHttpRequest) CloseConnection() {
+	if m.isBodySend {
+		return
+	}
+
+	m.isBodySend = true
+	m.isClosed = true
+
+	// The connection is closed once the hijack handler returns.
+	m.fast.HijackSetNoResponse(true)
+	m.fast.Hijack(func(c net.Conn) {})
+
+	m.unlockMutex()
+}
+
 func (m *fastHttpRequest) Return500ErrorPage(err error) {
 	m.host.OnError(m, err)
 }
@@ -280,6 +381,10 @@ func (m *fastHttpRequest) GetWildcards() []string {
 	return m.resolvedUrl.GetWildcards()
 }
 
+func (m *fastHttpRequest) GetParam(name string) string {
+	return m.resolvedUrl.GetParam(name)
+}
+
 func (m *fastHttpRequest) SendFile(filePath string) error {
 	if m.isBodySend {
 		return nil
@@ -409,3 +514,6 @@ func (m *fastHttpRequest) SendFileAsIs(filePath string, mimeType string, content
 
 	return nil
 }
+
+var gSchemeHttp = []byte("http")
+var gSchemeHttps = []byte("https")
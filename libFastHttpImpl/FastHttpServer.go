@@ -1,248 +1,237 @@
 package libFastHttpImpl
 
 import (
-	"crypto/tls"
+	"context"
 	"github.com/progpjs/httpServer/v2"
 	"github.com/valyala/fasthttp"
-	"golang.org/x/crypto/acme"
-	"golang.org/x/crypto/acme/autocert"
-	"os"
-	"path"
-	"strconv"
+	"log"
+	"net"
 	"sync"
 	"time"
 )
 
 type FastHttpServer struct {
-	port        int
-	isStarted   bool
-	startParams httpServer.StartParams
+	// lifecycle starts and stops the server.
+	lifecycle *httpServer.HttpServerLifecycle
 
-	hosts      map[string]*httpServer.HttpHost
-	hostsMutex sync.Mutex
+	// dispatcher contains the hosts and calls the handlers of the requests.
+	dispatcher *httpServer.HttpDispatcher
 
-	server           *fasthttp.Server
 	hideServerErrors bool
 }
 
 func NewFastHttpServer(port int) *FastHttpServer {
-	return &FastHttpServer{
-		port:  port,
-		hosts: make(map[string]*httpServer.HttpHost),
-	}
+	m := &FastHttpServer{}
+	m.dispatcher = httpServer.NewHttpDispatcher(m)
+	m.lifecycle = httpServer.NewHttpServerLifecycle(m, port, m.dispatcher, m.createEngine)
+	return m
 }
 
 func GetFastHttpServer(serverPort int) httpServer.HttpServer {
-	server := httpServer.GetHttpServer(serverPort)
-
-	if server == nil {
-		server = NewFastHttpServer(serverPort)
-		httpServer.RegisterServer(server)
-	}
+	return GetFastHttpServerAt("", serverPort)
+}
 
-	return server
+// GetFastHttpServerAt returns the server listening to this address and port,
+// creating it if needed. The address can be an IP or a listen address
+// as returned by StartParams.GetListenAddress.
+func GetFastHttpServerAt(bindAddress string, serverPort int) httpServer.HttpServer {
+	return httpServer.GetOrCreateHttpServerAt(bindAddress, serverPort, func(serverPort int) httpServer.HttpServer {
+		return NewFastHttpServer(serverPort)
+	})
 }
 
 func (m *FastHttpServer) GetPort() int {
-	return m.port
+	return m.lifecycle.GetPort()
+}
+
+func (m *FastHttpServer) GetBindAddress() string {
+	return m.lifecycle.GetBindAddress()
 }
 
 func (m *FastHttpServer) IsStarted() bool {
-	return m.isStarted
+	return m.lifecycle.IsStarted()
 }
 
-func (m *FastHttpServer) Shutdown() {
-	if !m.isStarted {
-		return
-	}
+func (m *FastHttpServer) Shutdown(timeout time.Duration) bool {
+	return m.lifecycle.Shutdown(timeout)
 }
 
+// StartServer starts the server and blocks until the server is stopped.
 func (m *FastHttpServer) StartServer() error {
-	if m.isStarted {
-		return nil
-	}
+	return m.lifecycle.StartServer()
+}
 
-	handler := func(fast *fasthttp.RequestCtx) {
-		hostName := UnsafeString(fast.Host())
-		method := UnsafeString(fast.Method())
-		rPath := UnsafeString(fast.Path())
-		methodCode := httpServer.MethodNameToMethodCode(method)
+// Start starts the server without blocking. It returns once the socket
+// is listening, or returns the error if the socket can't be bound.
+func (m *FastHttpServer) Start() error {
+	return m.lifecycle.Start()
+}
 
-		req := prepareFastHttpRequest(method, methodCode, rPath, fast)
+// Wait blocks until the server is stopped and returns the error
+// having stopped it, which is nil if stopped by Shutdown.
+func (m *FastHttpServer) Wait() error {
+	return m.lifecycle.Wait()
+}
 
-		host := m.hosts[hostName]
-		if host == nil {
-			req.Return500ErrorPage(nil)
-			return
-		}
-		//
-		req.host = host
+// Done returns a channel which is closed once the server is stopped.
+func (m *FastHttpServer) Done() <-chan struct{} {
+	return m.lifecycle.Done()
+}
 
-		resolver := host.GetUrlResolver(methodCode)
-		if resolver == nil {
-			host.OnNotFound(req)
-			return
-		}
+func (m *FastHttpServer) handleRequest(fast *fasthttp.RequestCtx) {
+	method := UnsafeString(fast.Method())
+	rPath := UnsafeString(fast.Path())
+	methodCode := httpServer.MethodNameToMethodCode(method)
 
-		resolvedUrl := resolver.Find(rPath)
-		if resolvedUrl.Target == nil {
-			host.OnNotFound(req)
-			return
-		}
+	req := prepareFastHttpRequest(method, methodCode, rPath, fast)
+	m.dispatcher.Dispatch(req, UnsafeString(fast.Host()))
+}
 
-		req.resolvedUrl = resolvedUrl
+// fastHttpEngine allows the lifecycle to use the fasthttp server.
+type fastHttpEngine struct {
+	server *fasthttp.Server
 
-		if resolvedUrl.Middlewares != nil {
-			for _, h := range resolvedUrl.Middlewares {
-				err := h.(httpServer.HttpMiddleware)(req)
+	// connections contains the opened connections.
+	// Allows closing them when the shutdown timeout is reached.
+	connections      map[net.Conn]struct{}
+	connectionsMutex sync.Mutex
+}
 
-				if err != nil {
-					host.OnError(req, err)
-					return
-				}
+func (m *fastHttpEngine) Serve(listener net.Listener) error {
+	// Returns nil once the server is shut down.
+	return m.server.Serve(listener)
+}
 
-				if req.MustStop() {
-					return
-				}
-			}
-		}
+func (m *fastHttpEngine) Shutdown(ctx context.Context) error {
+	return m.server.ShutdownWithContext(ctx)
+}
 
-		err := resolvedUrl.Target.(httpServer.HttpMiddleware)(req)
-		if err != nil {
-			host.OnError(req, err)
-		}
+func (m *fastHttpEngine) Close() {
+	m.connectionsMutex.Lock()
+	defer m.connectionsMutex.Unlock()
+
+	for conn := range m.connections {
+		_ = conn.Close()
 	}
 
+	m.connections = make(map[net.Conn]struct{})
+}
+
+func (m *fastHttpEngine) onConnState(conn net.Conn, state fasthttp.ConnState) {
+	m.connectionsMutex.Lock()
+	defer m.connectionsMutex.Unlock()
+
+	switch state {
+	case fasthttp.StateNew:
+		m.connections[conn] = struct{}{}
+	case fasthttp.StateClosed, fasthttp.StateHijacked:
+		delete(m.connections, conn)
+	}
+}
+
+// createEngine creates and configures the fasthttp server, including his certificates.
+func (m *FastHttpServer) createEngine(params *httpServer.StartParams, certificates *httpServer.CertificateStore) (httpServer.HttpServerEngine, httpServer.HttpServerEngineOptions, error) {
+	engine := &fastHttpEngine{connections: make(map[net.Conn]struct{})}
+
 	// Setting LogAllErrors to false avoid saturating the console.
-	m.server = &fasthttp.Server{
-		Handler:      handler,
+	server := &fasthttp.Server{
+		Handler:      m.handleRequest,
 		LogAllErrors: false,
+		ConnState:    engine.onConnState,
 
 		// Limit body size to 4Mo.
 		MaxRequestBodySize: 4 * 1024 * 1024,
 
 		// Limit to 10sec for receiving the complete request.
 		ReadTimeout: time.Second * 10,
+
+		WriteTimeout:     time.Second * time.Duration(params.WriteTimeoutInSec),
+		IdleTimeout:      time.Second * time.Duration(params.IdleTimeoutInSec),
+		Concurrency:      params.MaxConcurrency,
+		MaxConnsPerIP:    params.MaxConnsPerIP,
+		DisableKeepalive: params.DisableKeepAlive,
+		ReadBufferSize:   params.MaxHeaderSize,
+	}
+
+	engine.server = server
+
+	if params.MaxRequestBodySize > 0 {
+		server.MaxRequestBodySize = params.MaxRequestBodySize
+	}
+
+	if params.ReadTimeoutInSec > 0 {
+		server.ReadTimeout = time.Second * time.Duration(params.ReadTimeoutInSec)
 	}
 
 	if m.hideServerErrors {
-		m.server.LogAllErrors = false
+		server.LogAllErrors = false
 
-		m.server.ErrorHandler = func(ctx *fasthttp.RequestCtx, err error) {
+		server.ErrorHandler = func(ctx *fasthttp.RequestCtx, err error) {
 			// Do nothing, avoid saturating the console.
 		}
 	}
 
-	// Use a fake server name for security, making less simple
-	// for hacker to known what server technologies is used.
-	m.server.Name = "Apache/2.4.38 (Debian)"
-
-	sPort := ":" + strconv.Itoa(m.port)
-
-	if m.startParams.EnableHttps {
-		var customServerStart func() error
-
-		for _, httpsInfo := range m.startParams.Certificates {
-			host := m.GetHost(httpsInfo.Hostname)
-			host.AllowHttps()
-
-			// Note: use of dev certificate has been remove since it's no more supported by browsers.
-			// If you want to create a dev certificate, then use mkcert:
-			// https://github.com/FiloSottile/mkcert
-			//
-			// 1- mkcert -install		--> create the root CA certificat, which is required to create your own test certificate.
-			// 2- mkcert localhost
-
-			if httpsInfo.UseLetsEncrypt {
-				// Note: LetsEncrypt requires a CAA record on the DNS.
-				// It's why it can't be tested on a dev local server.
-				// See more: https://letsencrypt.org/docs/caa/
-				// Also for an alternative: https://go-acme.github.io/lego/installation/
-
-				certCacheDir := httpsInfo.CertCacheDir
-
-				if !path.IsAbs(certCacheDir) {
-					cwd, _ := os.Getwd()
-					certCacheDir = path.Join(cwd, certCacheDir)
-					_ = os.MkdirAll(certCacheDir, os.ModePerm)
-				}
-
-				manager := &autocert.Manager{
-					Prompt:     autocert.AcceptTOS,
-					HostPolicy: autocert.HostWhitelist(httpsInfo.Hostname),
-					Cache:      autocert.DirCache(certCacheDir),
-				}
-
-				if m.server.TLSConfig == nil {
-					m.server.TLSConfig = &tls.Config{}
-				}
-
-				m.server.TLSConfig.GetCertificate = manager.GetCertificate
-				m.server.TLSConfig.NextProtos = []string{"http/1.1", acme.ALPNProto}
-			} else {
-				certFilePath := httpsInfo.CertFilePath
-				keyFilePath := httpsInfo.KeyFilePath
-
-				if !path.IsAbs(certFilePath) || !path.IsAbs(keyFilePath) {
-					cwd, _ := os.Getwd()
-
-					if !path.IsAbs(certFilePath) {
-						certFilePath = path.Join(cwd, certFilePath)
-					}
-
-					if !path.IsAbs(keyFilePath) {
-						keyFilePath = path.Join(cwd, keyFilePath)
-					}
-				}
-
-				err := m.server.AppendCert(certFilePath, keyFilePath)
-				if err != nil {
-					return err
-				}
-			}
-		}
+	if params.HideServerName {
+		server.NoDefaultServerHeader = true
+	} else if params.ServerName != "" {
+		server.Name = params.ServerName
+	} else {
+		// Use a fake server name for security, making less simple
+		// for hacker to known what server technologies is used.
+		server.Name = "Apache/2.4.38 (Debian)"
+	}
 
-		if customServerStart == nil {
-			err := m.server.ListenAndServeTLS(sPort, "", "")
-			if err != nil {
-				return err
-			}
-		} else {
-			err := customServerStart()
-			if err != nil {
-				return err
-			}
-		}
+	// fasthttp limits the number of connections itself.
+	options := httpServer.HttpServerEngineOptions{}
 
-	} else {
-		err := m.server.ListenAndServe(sPort)
-		if err != nil {
-			return err
-		}
+	if certificates != nil {
+		server.TLSConfig = certificates.TLSConfig()
+		options.TLSConfig = server.TLSConfig
 	}
 
-	m.isStarted = true
-	return nil
+	return engine, options, nil
 }
 
 func (m *FastHttpServer) GetHost(hostName string) *httpServer.HttpHost {
-	m.hostsMutex.Lock()
-	defer m.hostsMutex.Unlock()
+	return m.dispatcher.GetHost(hostName)
+}
 
-	if (m.port != 80) && (m.port != 443) {
-		hostName += ":" + strconv.Itoa(m.port)
-	}
+func (m *FastHttpServer) AddHostAlias(alias string, host *httpServer.HttpHost, redirectToHost bool) error {
+	return m.dispatcher.AddHostAlias(alias, host, redirectToHost)
+}
 
-	host := m.hosts[hostName]
+func (m *FastHttpServer) SetDefaultHost(host *httpServer.HttpHost) {
+	m.dispatcher.SetDefaultHost(host)
+}
 
-	if host == nil {
-		host = httpServer.NewHttpHost(hostName, m, nil)
-		m.hosts[hostName] = host
-	}
+func (m *FastHttpServer) SetUnknownHostHandler(handler httpServer.UnknownHostHandler) {
+	m.dispatcher.SetUnknownHostHandler(handler)
+}
+
+func (m *FastHttpServer) GetCertificateStore() *httpServer.CertificateStore {
+	return m.lifecycle.GetCertificateStore()
+}
+
+func (m *FastHttpServer) GetLogger() *log.Logger {
+	return m.dispatcher.GetLogger()
+}
+
+func (m *FastHttpServer) SetLogger(logger *log.Logger) {
+	m.dispatcher.SetLogger(logger)
+}
+
+func (m *FastHttpServer) SetPanicHandler(handler httpServer.PanicHandler) {
+	m.dispatcher.SetPanicHandler(handler)
+}
+
+func (m *FastHttpServer) SetRequestHooks(hooks *httpServer.HttpRequestHooks) {
+	m.dispatcher.SetRequestHooks(hooks)
+}
 
-	return host
+func (m *FastHttpServer) GetRequestHooks() *httpServer.HttpRequestHooks {
+	return m.dispatcher.GetRequestHooks()
 }
 
 func (m *FastHttpServer) SetStartServerParams(params httpServer.StartParams) {
-	m.startParams = params
+	m.lifecycle.SetStartServerParams(params)
 }
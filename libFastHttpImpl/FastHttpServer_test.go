@@ -1,9 +1,35 @@
 package libFastHttpImpl
 
 import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
 	"github.com/progpjs/httpServer/v2"
+	"io"
 	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func Test1(test *testing.T) {
@@ -19,3 +45,1150 @@ func Test1(test *testing.T) {
 
 	log.Fatal(server.StartServer())
 }
+
+func TestStartAndShutdown(test *testing.T) {
+	server := NewFastHttpServer(8091)
+	httpServer.RegisterServer(server)
+
+	server.GetHost("localhost").GET("/", func(call httpServer.HttpRequest) error {
+		call.ReturnString(200, "hello world!")
+		return nil
+	})
+
+	err := server.Start()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if !server.IsStarted() {
+		test.Error("Server must be started once Start returns")
+	}
+
+	// The port is already used, the error must be returned immediately.
+	other := NewFastHttpServer(8091)
+	if other.Start() == nil {
+		test.Error("Binding an used port must fail")
+	}
+
+	res, err := http.Get("http://localhost:8091/")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	body, _ := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+
+	if string(body) != "hello world!" {
+		test.Error("Invalid response [", string(body), "]")
+	}
+
+	if !server.Shutdown(time.Second) {
+		test.Error("Shutdown must succeed when there is no pending request")
+	}
+
+	select {
+	case <-server.Done():
+	case <-time.After(time.Second):
+		test.Fatal("Done must be closed once the server is shut down")
+	}
+
+	if server.Wait() != nil {
+		test.Error("Wait must return nil after a shutdown")
+	}
+
+	if server.IsStarted() {
+		test.Error("Server must not be started after a shutdown")
+	}
+
+	if httpServer.GetHttpServer(8091) != nil {
+		test.Error("Server must be unregistered after a shutdown")
+	}
+
+	if GetFastHttpServer(8091) == server {
+		test.Error("A new server instance was expected")
+	}
+}
+
+func TestStartParamsLimits(test *testing.T) {
+	server := NewFastHttpServer(8092)
+
+	server.SetStartServerParams(httpServer.StartParams{
+		MaxRequestBodySize: 1024,
+		HideServerName:     true,
+	})
+
+	server.GetHost("localhost").POST("/", func(call httpServer.HttpRequest) error {
+		call.ReturnString(200, "ok")
+		return nil
+	})
+
+	err := server.Start()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	defer server.Shutdown(time.Second)
+
+	res, err := http.Post("http://localhost:8092/", "text/plain", strings.NewReader("small"))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	_ = res.Body.Close()
+
+	if res.StatusCode != 200 {
+		test.Error("Small body must be accepted, status is", res.StatusCode)
+	}
+
+	if res.Header.Get("Server") != "" {
+		test.Error("Server header must be hidden, found [", res.Header.Get("Server"), "]")
+	}
+
+	res, err = http.Post("http://localhost:8092/", "text/plain", strings.NewReader(strings.Repeat("x", 2048)))
+	if err == nil {
+		_ = res.Body.Close()
+
+		if res.StatusCode < 400 {
+			test.Error("Big body must be refused, status is", res.StatusCode)
+		}
+	}
+}
+
+func TestUnixSocket(test *testing.T) {
+	socketPath := path.Join(test.TempDir(), "server.sock")
+
+	server := GetFastHttpServerAt("unix:"+socketPath, 0).(*FastHttpServer)
+	defer server.Shutdown(time.Second)
+
+	if httpServer.GetHttpServerAt("unix:"+socketPath, 0) != server {
+		test.Error("Server must be registered with his socket path")
+	}
+
+	server.GetHost("localhost").GET("/", func(call httpServer.HttpRequest) error {
+		call.ReturnString(200, "from socket")
+		return nil
+	})
+
+	err := server.Start()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return net.Dial("unix", socketPath)
+			},
+		},
+	}
+
+	res, err := client.Get("http://localhost/")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	body, _ := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+
+	if string(body) != "from socket" {
+		test.Error("Invalid response [", string(body), "]")
+	}
+}
+
+func TestUnixSocketNotReplacingFile(test *testing.T) {
+	filePath := path.Join(test.TempDir(), "server.sock")
+
+	err := os.WriteFile(filePath, []byte("not a socket"), 0600)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	server := NewFastHttpServer(0)
+	server.SetStartServerParams(httpServer.StartParams{UnixSocketPath: filePath})
+
+	if server.Start() == nil {
+		server.Shutdown(time.Second)
+		test.Error("Start must fail when the path isn't a socket")
+	}
+
+	content, err := os.ReadFile(filePath)
+	if (err != nil) || (string(content) != "not a socket") {
+		test.Error("The file must not be removed [", err, "]")
+	}
+}
+
+func TestBindAddress(test *testing.T) {
+	server := NewFastHttpServer(8093)
+	server.SetStartServerParams(httpServer.StartParams{BindAddress: "127.0.0.1"})
+
+	err := server.Start()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	defer server.Shutdown(time.Second)
+
+	// Another interface can still use the same port.
+	other := NewFastHttpServer(8093)
+	other.SetStartServerParams(httpServer.StartParams{BindAddress: "127.0.0.2"})
+
+	err = other.Start()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	other.Shutdown(time.Second)
+}
+
+// sendAbsoluteFormRequest sends a GET request whose target contains the scheme and the host,
+// like a client talking to a proxy does. Go's http client can't send it to a server.
+func sendAbsoluteFormRequest(test *testing.T, address string, target string) *http.Response {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	_, err = fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: %s\r\nConnection: close\r\n\r\n", target, address)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	_, _ = io.ReadAll(res.Body)
+	_ = res.Body.Close()
+
+	return res
+}
+
+// createTestCertificate creates a self-signed certificate for the hostname
+// and returns the path of the certificate file and the key file.
+func createTestCertificate(test *testing.T, hostname string, notAfter time.Time) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: hostname},
+		DNSNames:     []string{hostname},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	dir := test.TempDir()
+	certFilePath := path.Join(dir, "cert.pem")
+	keyFilePath := path.Join(dir, "key.pem")
+
+	_ = os.WriteFile(certFilePath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	_ = os.WriteFile(keyFilePath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+
+	return certFilePath, keyFilePath
+}
+
+func TestHttpAndHttps(test *testing.T) {
+	certFilePath, keyFilePath := createTestCertificate(test, "localhost", time.Now().Add(time.Hour))
+
+	server := NewFastHttpServer(8094)
+
+	server.SetStartServerParams(httpServer.StartParams{
+		EnableHttps: true,
+		HttpsPort:   8095,
+
+		Certificates: []httpServer.HttpsCertificateParams{{
+			Hostname:        "localhost",
+			CertFilePath:    certFilePath,
+			KeyFilePath:     keyFilePath,
+			ForceHttps:      true,
+			HstsMaxAgeInSec: 3600,
+		}},
+	})
+
+	server.GetHost("localhost").GET("/scheme", func(call httpServer.HttpRequest) error {
+		call.ReturnString(200, string(call.URI().UriScheme()))
+		return nil
+	})
+
+	err := server.Start()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	defer server.Shutdown(time.Second)
+
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	// >>> Http must be redirected
+
+	res, err := client.Get("http://localhost:8094/scheme?a=b")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	_ = res.Body.Close()
+
+	if res.StatusCode != 301 {
+		test.Error("Expected a 301 redirect, found", res.StatusCode)
+	}
+
+	if location := res.Header.Get("Location"); location != "https://localhost:8095/scheme?a=b" {
+		test.Error("Invalid redirect location [", location, "]")
+	}
+
+	res = sendAbsoluteFormRequest(test, "localhost:8094", "http://localhost:8094/scheme?a=b")
+	if location := res.Header.Get("Location"); (res.StatusCode != 301) || (location != "https://localhost:8095/scheme?a=b") {
+		test.Error("Invalid redirect location for an absolute-form request [", res.StatusCode, location, "]")
+	}
+
+	res, err = client.Post("http://localhost:8094/scheme", "text/plain", strings.NewReader("body"))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	_ = res.Body.Close()
+
+	if res.StatusCode != 308 {
+		test.Error("Expected a 308 redirect for POST, found", res.StatusCode)
+	}
+
+	// >>> Https must be served
+
+	res, err = client.Get("https://localhost:8095/scheme")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	body, _ := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+
+	if string(body) != "https" {
+		test.Error("Invalid scheme [", string(body), "]")
+	}
+
+	if hsts := res.Header.Get("Strict-Transport-Security"); hsts != "max-age=3600" {
+		test.Error("Invalid HSTS header [", hsts, "]")
+	}
+}
+
+func TestAcmeHttpChallenge(test *testing.T) {
+	eabHmacKey := []byte("my-eab-hmac-key")
+	acmeServer := newAcmeServerStub(test, "my-eab-kid", eabHmacKey, "127.0.0.1:8096")
+	defer acmeServer.server.Close()
+
+	server := NewFastHttpServer(8096)
+
+	server.SetStartServerParams(httpServer.StartParams{
+		EnableHttps: true,
+		HttpsPort:   8097,
+
+		Certificates: []httpServer.HttpsCertificateParams{{
+			// The ACME clients refuse the names without dot, like "localhost".
+			Hostname:            "acme.localhost",
+			UseLetsEncrypt:      true,
+			CertCacheDir:        test.TempDir(),
+			AcmeDirectoryUrl:    acmeServer.server.URL + "/dir",
+			AcmeDirectoryCaFile: acmeServer.writeTlsCertificate(),
+			AcmeEmail:           "admin@acme.localhost",
+			AcmeEabKeyId:        "my-eab-kid",
+			AcmeEabHmacKey:      base64.RawURLEncoding.EncodeToString(eabHmacKey),
+			AcmeChallengeType:   httpServer.AcmeChallengeHttp,
+			ForceHttps:          true,
+		}},
+	})
+
+	err := server.Start()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	defer server.Shutdown(time.Second)
+
+	status, _ := getWithHost(test, "http://127.0.0.1:8096"+httpServer.AcmeChallengePath+"unknown", "acme.localhost:8096")
+	if status != 404 {
+		test.Error("Unknown token must return a 404, found", status)
+	}
+
+	// The handshake asks the certificate to the ACME server, which checks the http-01 token.
+	conn, err := tls.Dial("tcp", "127.0.0.1:8097", &tls.Config{ServerName: "acme.localhost", RootCAs: acmeServer.getCaPool()})
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	_ = conn.Close()
+
+	acmeServer.mutex.Lock()
+	defer acmeServer.mutex.Unlock()
+
+	if !acmeServer.isChallengeValid {
+		test.Error("The http-01 challenge must have been answered")
+	}
+
+	if acmeServer.contact != "mailto:admin@acme.localhost" {
+		test.Error("Invalid account contact [", acmeServer.contact, "]")
+	}
+}
+
+func TestAcmeHttpChallengeWithoutHttpsPort(test *testing.T) {
+	server := NewFastHttpServer(8105)
+
+	server.SetStartServerParams(httpServer.StartParams{
+		EnableHttps: true,
+
+		Certificates: []httpServer.HttpsCertificateParams{{
+			Hostname:          "acme.localhost",
+			UseLetsEncrypt:    true,
+			CertCacheDir:      test.TempDir(),
+			AcmeChallengeType: httpServer.AcmeChallengeHttp,
+		}},
+	})
+
+	if server.Start() == nil {
+		server.Shutdown(time.Second)
+		test.Error("The http-01 challenge must be refused without plain http port")
+	}
+}
+
+// acmeServerStub is a minimal ACME server, allowing to test the order flow with the
+// http-01 challenge. It checks the EAB of the account and signs the certificates with his own CA.
+type acmeServerStub struct {
+	test   *testing.T
+	server *httptest.Server
+
+	eabKeyId   string
+	eabHmacKey []byte
+
+	// challengeAddress is where the http-01 token is requested, instead of the port 80.
+	challengeAddress string
+
+	caKey  *ecdsa.PrivateKey
+	caCert *x509.Certificate
+
+	mutex            sync.Mutex
+	thumbprint       string
+	contact          string
+	isChallengeValid bool
+	certificatePem   []byte
+}
+
+const acmeStubToken = "my-token"
+
+func newAcmeServerStub(test *testing.T, eabKeyId string, eabHmacKey []byte, challengeAddress string) *acmeServerStub {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ACME stub CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	caDer, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	caCert, _ := x509.ParseCertificate(caDer)
+
+	m := &acmeServerStub{
+		test:             test,
+		eabKeyId:         eabKeyId,
+		eabHmacKey:       eabHmacKey,
+		challengeAddress: challengeAddress,
+		caKey:            caKey,
+		caCert:           caCert,
+	}
+
+	m.server = httptest.NewTLSServer(http.HandlerFunc(m.serveHTTP))
+	return m
+}
+
+// writeTlsCertificate writes the certificate of the https server of the stub, which isn't trusted by the system.
+func (m *acmeServerStub) writeTlsCertificate() string {
+	filePath := path.Join(m.test.TempDir(), "acme-server.pem")
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: m.server.Certificate().Raw})
+
+	err := os.WriteFile(filePath, certPem, 0600)
+	if err != nil {
+		m.test.Fatal(err)
+	}
+
+	return filePath
+}
+
+// getCaPool returns a pool with the CA signing the certificates ordered.
+func (m *acmeServerStub) getCaPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(m.caCert)
+	return pool
+}
+
+func (m *acmeServerStub) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	baseUrl := m.server.URL
+
+	w.Header().Set("Replay-Nonce", strconv.FormatInt(time.Now().UnixNano(), 36))
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.URL.Path == "/dir" {
+		m.writeJson(w, 200, map[string]any{
+			"newNonce":   baseUrl + "/nonce",
+			"newAccount": baseUrl + "/account",
+			"newOrder":   baseUrl + "/order",
+			"revokeCert": baseUrl + "/revoke",
+			"keyChange":  baseUrl + "/key-change",
+			"meta":       map[string]any{"externalAccountRequired": true},
+		})
+
+		return
+	}
+
+	if r.URL.Path == "/nonce" {
+		w.WriteHeader(200)
+		return
+	}
+
+	jwk, payload, err := readAcmeJws(r)
+	if err != nil {
+		m.test.Error("Invalid ACME request [", r.URL.Path, err, "]")
+		m.writeJson(w, 400, map[string]any{"type": "urn:ietf:params:acme:error:malformed"})
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	order := map[string]any{
+		"status":         "pending",
+		"identifiers":    []map[string]any{{"type": "dns", "value": "acme.localhost"}},
+		"authorizations": []string{baseUrl + "/authz"},
+		"finalize":       baseUrl + "/finalize",
+	}
+
+	if m.isChallengeValid {
+		order["status"] = "ready"
+	}
+
+	if m.certificatePem != nil {
+		order["status"] = "valid"
+		order["certificate"] = baseUrl + "/cert"
+	}
+
+	w.Header().Set("Location", baseUrl+"/order/1")
+
+	switch r.URL.Path {
+	case "/account":
+		err = m.checkAccount(jwk, payload)
+		if err != nil {
+			m.test.Error("Invalid ACME account [", err, "]")
+			m.writeJson(w, 400, map[string]any{"type": "urn:ietf:params:acme:error:externalAccountRequired"})
+			return
+		}
+
+		w.Header().Set("Location", baseUrl+"/account/1")
+		m.writeJson(w, 201, map[string]any{"status": "valid"})
+
+	case "/order":
+		m.writeJson(w, 201, order)
+
+	case "/order/1":
+		m.writeJson(w, 200, order)
+
+	case "/authz":
+		status := "pending"
+		if m.isChallengeValid {
+			status = "valid"
+		}
+
+		m.writeJson(w, 200, map[string]any{
+			"status":     status,
+			"identifier": map[string]any{"type": "dns", "value": "acme.localhost"},
+			"challenges": []map[string]any{m.getChallenge()},
+		})
+
+	case "/challenge":
+		m.isChallengeValid = m.checkHttpToken()
+
+		if !m.isChallengeValid {
+			m.test.Error("The http-01 token isn't valid")
+		}
+
+		m.writeJson(w, 200, m.getChallenge())
+
+	case "/finalize":
+		err = m.signCertificate(payload)
+		if err != nil {
+			m.test.Error("Can't sign the certificate [", err, "]")
+			m.writeJson(w, 400, map[string]any{"type": "urn:ietf:params:acme:error:badCSR"})
+			return
+		}
+
+		order["status"] = "valid"
+		order["certificate"] = baseUrl + "/cert"
+		m.writeJson(w, 200, order)
+
+	case "/cert":
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		_, _ = w.Write(m.certificatePem)
+
+	default:
+		w.WriteHeader(404)
+	}
+}
+
+func (m *acmeServerStub) writeJson(w http.ResponseWriter, status int, value any) {
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func (m *acmeServerStub) getChallenge() map[string]any {
+	status := "pending"
+	if m.isChallengeValid {
+		status = "valid"
+	}
+
+	return map[string]any{
+		"type":   "http-01",
+		"url":    m.server.URL + "/challenge",
+		"token":  acmeStubToken,
+		"status": status,
+	}
+}
+
+// checkAccount checks the EAB, which is signed with the hmac key and contains the key of the account.
+func (m *acmeServerStub) checkAccount(jwk json.RawMessage, payload []byte) error {
+	var account struct {
+		Contact                []string
+		ExternalAccountBinding *acmeJws
+	}
+
+	err := json.Unmarshal(payload, &account)
+	if err != nil {
+		return err
+	}
+
+	if account.ExternalAccountBinding == nil {
+		return errors.New("no EAB")
+	}
+
+	eab := account.ExternalAccountBinding
+
+	mac := hmac.New(sha256.New, m.eabHmacKey)
+	mac.Write([]byte(eab.Protected + "." + eab.Payload))
+
+	signature, _ := base64.RawURLEncoding.DecodeString(eab.Signature)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return errors.New("invalid EAB signature")
+	}
+
+	var eabHeader struct{ Kid string }
+	eabHeaderJson, _ := base64.RawURLEncoding.DecodeString(eab.Protected)
+	_ = json.Unmarshal(eabHeaderJson, &eabHeader)
+
+	if eabHeader.Kid != m.eabKeyId {
+		return errors.New("invalid EAB key id " + eabHeader.Kid)
+	}
+
+	if len(account.Contact) != 0 {
+		m.contact = account.Contact[0]
+	}
+
+	// The JWK of the account key is already in the canonical form of RFC 7638.
+	thumbprint := sha256.Sum256(jwk)
+	m.thumbprint = base64.RawURLEncoding.EncodeToString(thumbprint[:])
+
+	return nil
+}
+
+// checkHttpToken requests the token on the plain http port, like a CA does on the port 80.
+func (m *acmeServerStub) checkHttpToken() bool {
+	status, body := getWithHost(m.test, "http://"+m.challengeAddress+httpServer.AcmeChallengePath+acmeStubToken, "acme.localhost")
+	return (status == 200) && (body == acmeStubToken+"."+m.thumbprint)
+}
+
+func (m *acmeServerStub) signCertificate(payload []byte) error {
+	var finalize struct{ Csr string }
+
+	err := json.Unmarshal(payload, &finalize)
+	if err != nil {
+		return err
+	}
+
+	csrDer, err := base64.RawURLEncoding.DecodeString(finalize.Csr)
+	if err != nil {
+		return err
+	}
+
+	csr, err := x509.ParseCertificateRequest(csrDer)
+	if err != nil {
+		return err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: csr.DNSNames[0]},
+		DNSNames:     csr.DNSNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, m.caCert, csr.PublicKey, m.caKey)
+	if err != nil {
+		return err
+	}
+
+	m.certificatePem = append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: m.caCert.Raw})...)
+
+	return nil
+}
+
+type acmeJws struct {
+	Protected string `json:"protected"`
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+// readAcmeJws returns the JWK of the header, which is only set when creating the account, and the payload.
+func readAcmeJws(r *http.Request) (json.RawMessage, []byte, error) {
+	var jws acmeJws
+
+	err := json.NewDecoder(r.Body).Decode(&jws)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	headerJson, err := base64.RawURLEncoding.DecodeString(jws.Protected)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var header struct {
+		Jwk json.RawMessage `json:"jwk"`
+	}
+
+	err = json.Unmarshal(headerJson, &header)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(jws.Payload)
+	return header.Jwk, payload, err
+}
+
+// getWithHost sends a GET request with this Host header and returns the status and the body.
+func getWithHost(test *testing.T, url string, host string) (int, string) {
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Host = host
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		test.Error(err)
+		return 0, ""
+	}
+
+	body, _ := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+
+	return res.StatusCode, string(body)
+}
+
+func TestClientCertificate(test *testing.T) {
+	certFilePath, keyFilePath := createTestCertificate(test, "localhost", time.Now().Add(time.Hour))
+
+	// The self-signed client certificate is his own CA.
+	clientCertFilePath, clientKeyFilePath := createTestCertificate(test, "my-service", time.Now().Add(time.Hour))
+
+	server := NewFastHttpServer(8098)
+
+	server.SetStartServerParams(httpServer.StartParams{
+		EnableHttps: true,
+
+		Certificates: []httpServer.HttpsCertificateParams{{
+			Hostname:       "localhost",
+			CertFilePath:   certFilePath,
+			KeyFilePath:    keyFilePath,
+			ClientAuthMode: httpServer.ClientAuthRequired,
+			ClientCaFile:   clientCertFilePath,
+		}},
+	})
+
+	server.GetHost("localhost").GET("/", func(call httpServer.HttpRequest) error {
+		clientCert := call.GetClientCertificate()
+
+		if clientCert == nil {
+			call.ReturnString(200, "anonymous")
+		} else {
+			call.ReturnString(200, clientCert.CommonName+"|"+strings.Join(clientCert.DNSNames, ","))
+		}
+
+		return nil
+	})
+
+	err := server.Start()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	defer server.Shutdown(time.Second)
+
+	// >>> Without certificate the connection is refused
+
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+
+	res, err := client.Get("https://localhost:8098/")
+	if err == nil {
+		_ = res.Body.Close()
+		test.Error("A request without client certificate must be refused")
+	}
+
+	// >>> With certificate
+
+	clientCert, err := tls.LoadX509KeyPair(clientCertFilePath, clientKeyFilePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	client = &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true,
+			Certificates:       []tls.Certificate{clientCert},
+		}},
+	}
+
+	res, err = client.Get("https://localhost:8098/")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	body, _ := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+
+	if string(body) != "my-service|my-service" {
+		test.Error("Invalid client certificate [", string(body), "]")
+	}
+}
+
+func TestClientCertificateBypass(test *testing.T) {
+	publicCertFilePath, publicKeyFilePath := createTestCertificate(test, "public.localhost", time.Now().Add(time.Hour))
+	secureCertFilePath, secureKeyFilePath := createTestCertificate(test, "secure.localhost", time.Now().Add(time.Hour))
+	clientCertFilePath, _ := createTestCertificate(test, "my-service", time.Now().Add(time.Hour))
+
+	server := NewFastHttpServer(8104)
+
+	server.SetStartServerParams(httpServer.StartParams{
+		EnableHttps: true,
+
+		Certificates: []httpServer.HttpsCertificateParams{{
+			Hostname:     "public.localhost",
+			CertFilePath: publicCertFilePath,
+			KeyFilePath:  publicKeyFilePath,
+		}, {
+			Hostname:       "secure.localhost",
+			CertFilePath:   secureCertFilePath,
+			KeyFilePath:    secureKeyFilePath,
+			ClientAuthMode: httpServer.ClientAuthRequired,
+			ClientCaFile:   clientCertFilePath,
+		}},
+	})
+
+	for _, hostName := range []string{"public.localhost", "secure.localhost"} {
+		body := hostName
+
+		server.GetHost(hostName).GET("/", func(call httpServer.HttpRequest) error {
+			call.ReturnString(200, body)
+			return nil
+		})
+	}
+
+	err := server.Start()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	defer server.Shutdown(time.Second)
+
+	// The handshake is done for the public host, which doesn't ask a certificate.
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true,
+			ServerName:         "public.localhost",
+		}},
+	}
+
+	get := func(hostName string) (int, string) {
+		req, _ := http.NewRequest("GET", "https://127.0.0.1:8104/", nil)
+		req.Host = hostName
+
+		res, err := client.Do(req)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		body, _ := io.ReadAll(res.Body)
+		_ = res.Body.Close()
+
+		return res.StatusCode, string(body)
+	}
+
+	if status, body := get("public.localhost"); (status != 200) || (body != "public.localhost") {
+		test.Error("Invalid response for the public host [", status, body, "]")
+	}
+
+	if status, body := get("secure.localhost"); status != 421 {
+		test.Error("The secure host must not be reachable without certificate [", status, body, "]")
+	}
+}
+
+func TestDevCertificates(test *testing.T) {
+	caFilePath := path.Join(test.TempDir(), "ca.pem")
+	server := NewFastHttpServer(8099)
+
+	server.SetStartServerParams(httpServer.StartParams{
+		DevCertificates: &httpServer.DevCertificatesParams{
+			Hostnames:    []string{"localhost"},
+			ExportCaFile: caFilePath,
+		},
+	})
+
+	server.GetHost("localhost").GET("/", func(call httpServer.HttpRequest) error {
+		call.ReturnString(200, "trusted")
+		return nil
+	})
+
+	err := server.Start()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	defer server.Shutdown(time.Second)
+
+	caPem, err := os.ReadFile(caFilePath)
+	if err != nil {
+		test.Fatal("The CA must be exported:", err)
+	}
+
+	err = AddFetchTrustedCaPem(caPem)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	res, err := Fetch("https://localhost:8099/", "GET", FetchOptions{})
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	defer res.Dispose()
+
+	body, _ := res.GetBodyAsString()
+	if body != "trusted" {
+		test.Error("Invalid response [", body, "]")
+	}
+}
+
+func TestUnknownHost(test *testing.T) {
+	server := NewFastHttpServer(8100)
+
+	server.GetHost("localhost").GET("/path", func(call httpServer.HttpRequest) error {
+		call.ReturnString(200, "localhost")
+		return nil
+	})
+
+	err := server.Start()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	defer server.Shutdown(time.Second)
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	// The server is requested with his IP, which isn't a known host.
+	get := func() (*http.Response, error) {
+		res, err := client.Get("http://127.0.0.1:8100/path?a=b")
+		if err == nil {
+			_ = res.Body.Close()
+		}
+
+		return res, err
+	}
+
+	if res, err := get(); (err != nil) || (res.StatusCode != 404) {
+		test.Error("A 404 is expected by default:", res, err)
+	}
+
+	server.SetUnknownHostHandler(httpServer.UnknownHostMisdirected)
+
+	if res, err := get(); (err != nil) || (res.StatusCode != 421) {
+		test.Error("A 421 is expected:", res, err)
+	}
+
+	server.SetUnknownHostHandler(httpServer.UnknownHostRedirect("https://www.example.com/"))
+
+	if res, err := get(); (err != nil) || (res.Header.Get("Location") != "https://www.example.com/path?a=b") {
+		test.Error("A redirect is expected:", res, err)
+	}
+
+	server.SetUnknownHostHandler(httpServer.UnknownHostClose)
+
+	if _, err := get(); err == nil {
+		test.Error("The connection must be closed")
+	}
+
+	server.SetDefaultHost(server.GetHost("localhost"))
+
+	if res, err := get(); (err != nil) || (res.StatusCode != 200) {
+		test.Error("The default host must answer:", res, err)
+	}
+}
+
+func TestPanicRecovery(test *testing.T) {
+	server := NewFastHttpServer(8101)
+	server.SetLogger(log.New(io.Discard, "", 0))
+
+	server.GetHost("localhost").GET("/panic", func(call httpServer.HttpRequest) error {
+		panic("boom")
+	})
+
+	err := server.Start()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	defer server.Shutdown(time.Second)
+
+	for i := 0; i < 2; i++ {
+		res, err := http.Get("http://localhost:8101/panic")
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		_ = res.Body.Close()
+
+		if res.StatusCode != 500 {
+			test.Error("Invalid status after a panic [", res.StatusCode, "]")
+		}
+	}
+}
+
+func TestHeadFallback(test *testing.T) {
+	server := NewFastHttpServer(8102)
+
+	server.GetHost("localhost").GET("/page", func(call httpServer.HttpRequest) error {
+		if !call.IsHead() {
+			test.Error("The request must be a HEAD request")
+		}
+
+		call.ReturnString(200, "hello world")
+		return nil
+	})
+
+	err := server.Start()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	defer server.Shutdown(time.Second)
+
+	res, err := http.Head("http://localhost:8102/page")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	body, _ := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+
+	if (res.StatusCode != 200) || (res.ContentLength != 11) || (len(body) != 0) {
+		test.Error("Invalid HEAD response [", res.StatusCode, res.ContentLength, string(body), "]")
+	}
+}
+
+func TestRequestHooks(test *testing.T) {
+	server := NewFastHttpServer(8103)
+	host := server.GetHost("localhost")
+
+	events := make(chan string, 20)
+
+	server.SetRequestHooks(&httpServer.HttpRequestHooks{
+		OnRouteMatched: func(req httpServer.HttpRequest, pattern string, tag any) {
+			events <- "route:" + pattern
+		},
+
+		OnRequestFinished: func(req httpServer.HttpRequest, response httpServer.HttpResponseInfo) {
+			events <- "finished:" + strconv.Itoa(response.Status) + ":" + strconv.FormatInt(response.BytesSent, 10)
+		},
+
+		OnRequestAborted: func(req httpServer.HttpRequest, reason error) {
+			events <- "aborted:" + reason.Error()
+		},
+	})
+
+	host.GET("/hello", func(call httpServer.HttpRequest) error {
+		call.ReturnString(200, "hello")
+		return nil
+	})
+
+	host.GET("/close", func(call httpServer.HttpRequest) error {
+		call.(httpServer.HttpRoutableRequest).CloseConnection()
+		return nil
+	})
+
+	err := server.Start()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	defer server.Shutdown(time.Second)
+
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+	for _, expected := range []string{"/hello route:/hello finished:200:5", "/close route:/close aborted:connection closed"} {
+		rPath, expected, _ := strings.Cut(expected, " ")
+
+		res, err := client.Get("http://localhost:8103" + rPath)
+		if err == nil {
+			_ = res.Body.Close()
+		}
+
+		found := <-events + " " + <-events
+		if found != expected {
+			test.Error("Invalid hooks [", found, "] expected [", expected, "]")
+		}
+	}
+}
@@ -2,6 +2,9 @@ package libFastHttpImpl
 
 import (
 	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"github.com/progpjs/httpServer/v2"
 	"github.com/valyala/fasthttp"
 	"os"
@@ -14,6 +17,41 @@ import (
 var gFetchHttpClient *fasthttp.Client
 var gFetchHttpClientMutex sync.Mutex
 
+// gFetchRootCAs are the CA trusted by Fetch. If nil, the system CA are used.
+var gFetchRootCAs *x509.CertPool
+
+// AddFetchTrustedCaPem allows Fetch to trust the certificates signed by these CA certificates,
+// in addition to the system CA. It's mainly used with the development certificates.
+func AddFetchTrustedCaPem(caPem []byte) error {
+	gFetchHttpClientMutex.Lock()
+	defer gFetchHttpClientMutex.Unlock()
+
+	// The current client can be doing handshakes with the pool,
+	// which is why the certificates are added to a copy.
+	var pool *x509.CertPool
+
+	if gFetchRootCAs == nil {
+		systemPool, err := x509.SystemCertPool()
+		if err != nil {
+			systemPool = x509.NewCertPool()
+		}
+
+		pool = systemPool
+	} else {
+		pool = gFetchRootCAs.Clone()
+	}
+
+	if !pool.AppendCertsFromPEM(caPem) {
+		return errors.New("no certificate found")
+	}
+
+	gFetchRootCAs = pool
+
+	// Force the client to be rebuilt with the new CA.
+	gFetchHttpClient = nil
+	return nil
+}
+
 func initFetchHttpClient() {
 	gFetchHttpClientMutex.Lock()
 	defer gFetchHttpClientMutex.Unlock()
@@ -60,12 +98,18 @@ func initFetchHttpClient() {
 		//
 		StreamResponseBody: true,
 	}
+
+	if gFetchRootCAs != nil {
+		gFetchHttpClient.TLSConfig = &tls.Config{RootCAs: gFetchRootCAs}
+	}
 }
 
 func Fetch(url string, methodName string, options FetchOptions) (httpServer.FetchResult, error) {
-	if gFetchHttpClient == nil {
-		initFetchHttpClient()
-	}
+	initFetchHttpClient()
+
+	gFetchHttpClientMutex.Lock()
+	client := gFetchHttpClient
+	gFetchHttpClientMutex.Unlock()
 
 	var port string
 	portIdx := strings.Index(url, ":")
@@ -139,7 +183,7 @@ func Fetch(url string, methodName string, options FetchOptions) (httpServer.Fetc
 
 	resp.SkipBody = options.SkipBody
 
-	err := gFetchHttpClient.Do(req, resp)
+	err := client.Do(req, resp)
 	//err := gFetchHttpClient.DoRedirects(req, resp, 5)
 	if err != nil {
 		return nil, err
@@ -185,6 +185,15 @@ func (m *fastFileServer) handleRequest(call httpServer.HttpRequest) (bool, error
 		filePath = "/index.html"
 	} else if filePath[len(filePath)-1] == '/' {
 		filePath += "index.html"
+	} else if m.isDirectory(baseDir, filePath) {
+		// A directory requested without trailing slash follows the routing policy of the host.
+		switch call.GetHost().GetRoutingPolicy().TrailingSlash {
+		case httpServer.TrailingSlashRedirect:
+			httpServer.RedirectWithTrailingSlash(call)
+			return true, nil
+		case httpServer.TrailingSlashMatchBoth:
+			filePath += "/index.html"
+		}
 	}
 
 	filePath = path.Join(baseDir, filePath[len(m.basePath):])
@@ -210,6 +219,22 @@ func (m *fastFileServer) handleRequest(call httpServer.HttpRequest) (bool, error
 	return true, nil
 }
 
+// isDirectory returns true if the path of the request designs a directory inside baseDir.
+func (m *fastFileServer) isDirectory(baseDir string, filePath string) bool {
+	relPath := ""
+	if len(filePath) > len(m.basePath) {
+		relPath = filePath[len(m.basePath):]
+	}
+
+	dirPath := path.Join(baseDir, relPath)
+	if !strings.HasPrefix(dirPath, baseDir) {
+		return false
+	}
+
+	stat, err := os.Stat(dirPath)
+	return (err == nil) && stat.IsDir()
+}
+
 func (m *fastFileServer) sendFile(call httpServer.HttpRequest, cacheEntry *fastFileServerEntry) error {
 	fastRequest := call.(*fastHttpRequest)
 	ctx := fastRequest.fast
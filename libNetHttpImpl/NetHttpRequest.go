@@ -0,0 +1,456 @@
+package libNetHttpImpl
+
+import (
+	"errors"
+	"github.com/progpjs/httpServer/v2"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type netHttpRequest struct {
+	writer       http.ResponseWriter
+	statusWriter *statusWriter
+	request      *http.Request
+
+	path       string
+	methodName string
+	methodCode httpServer.HttpMethod
+	host       *httpServer.HttpHost
+
+	mustStop   bool
+	isBodySend bool
+
+	unlockMutex_ sync.Mutex
+	resolvedUrl  httpServer.UrlResolverResult
+
+	multiPartForm *httpServer.HttpMultiPartForm
+	queryArgs     *urlValueSet
+	postArgs      *urlValueSet
+}
+
+func prepareNetHttpRequest(w http.ResponseWriter, r *http.Request) *netHttpRequest {
+	sw := &statusWriter{ResponseWriter: w}
+
+	m := netHttpRequest{
+		methodName:   r.Method,
+		methodCode:   httpServer.MethodNameToMethodCode(r.Method),
+		path:         normalizePath(r.URL.Path),
+		writer:       sw,
+		statusWriter: sw,
+		request:      r,
+	}
+
+	m.unlockMutex_.Lock()
+	return &m
+}
+
+// normalizePath removes the "..", "." and duplicate slashes, like fasthttp does.
+func normalizePath(p string) string {
+	if p == "" {
+		return "/"
+	}
+
+	res := path.Clean(p)
+
+	if (p[len(p)-1] == '/') && (res != "/") {
+		res += "/"
+	}
+
+	return res
+}
+
+func (m *netHttpRequest) GetMethodName() string {
+	return m.methodName
+}
+
+func (m *netHttpRequest) GetMethodCode() httpServer.HttpMethod {
+	return m.methodCode
+}
+
+func (m *netHttpRequest) GetContentLength() int {
+	return int(m.request.ContentLength)
+}
+
+func (m *netHttpRequest) IsHead() bool {
+	return m.methodCode == httpServer.HttpMethodHEAD
+}
+
+func (m *netHttpRequest) IsBodySend() bool {
+	return m.isBodySend
+}
+
+func (m *netHttpRequest) SetHeader(key, value string) {
+	m.writer.Header().Set(key, value)
+}
+
+func (m *netHttpRequest) GetHeaders() map[string]string {
+	res := make(map[string]string)
+
+	// net/http removes the host from the headers.
+	res["Host"] = m.request.Host
+
+	for key, values := range m.request.Header {
+		if len(values) != 0 {
+			res[key] = values[0]
+		}
+	}
+
+	return res
+}
+
+func (m *netHttpRequest) GetContentType() string {
+	return m.request.Header.Get("Content-Type")
+}
+
+func (m *netHttpRequest) SetContentType(contentType string) {
+	m.writer.Header().Set("Content-Type", contentType)
+}
+
+func (m *netHttpRequest) ReturnString(status int, text string) {
+	if !m.isBodySend {
+		m.isBodySend = true
+
+		if m.IsHead() {
+			// net/http doesn't calculate the size when the body isn't sent.
+			if (status >= 200) && (status != 204) && (status != 304) {
+				m.writer.Header().Set("Content-Length", strconv.Itoa(len(text)))
+			}
+
+			m.writer.WriteHeader(status)
+		} else {
+			m.writer.WriteHeader(status)
+			_, _ = io.WriteString(m.writer, text)
+		}
+
+		m.unlockMutex()
+	}
+}
+
+func (m *netHttpRequest) GetQueryArgs() httpServer.ValueSet {
+	if m.queryArgs == nil {
+		m.queryArgs = newUrlValueSet(m.request.URL.Query(), m.request.URL.RawQuery)
+	}
+
+	return m.queryArgs
+}
+
+func (m *netHttpRequest) GetPostArgs() httpServer.ValueSet {
+	if m.postArgs == nil {
+		// On error, the values which can be read are returned.
+		_ = m.request.ParseForm()
+		m.postArgs = newUrlValueSet(m.request.PostForm, m.request.PostForm.Encode())
+	}
+
+	return m.postArgs
+}
+
+func (m *netHttpRequest) SetCookie(key string, value string, cookie httpServer.HttpCookieOptions) error {
+	c := &http.Cookie{
+		Name:     key,
+		Value:    value,
+		Domain:   cookie.Domain,
+		HttpOnly: cookie.IsHttpOnly,
+		Secure:   cookie.IsSecure,
+		SameSite: http.SameSite(cookie.SameSiteType),
+	}
+
+	if cookie.MaxAge > 0 {
+		c.MaxAge = cookie.MaxAge
+	}
+
+	if cookie.ExpireTime > 0 {
+		c.Expires = time.Unix(cookie.ExpireTime, 0)
+	}
+
+	http.SetCookie(m.writer, c)
+
+	return nil
+}
+
+func (m *netHttpRequest) GetCookies() (map[string]map[string]any, error) {
+	res := make(map[string]map[string]any)
+
+	for _, c := range m.request.Cookies() {
+		if c.Value == "" {
+			continue
+		}
+
+		res[c.Name] = cookieToJson(c)
+	}
+
+	return res, nil
+}
+
+func (m *netHttpRequest) GetCookie(name string) (map[string]any, error) {
+	c, err := m.request.Cookie(name)
+	if err != nil {
+		return cookieToJson(&http.Cookie{}), err
+	}
+
+	return cookieToJson(c), nil
+}
+
+const gContentTypeMultipartFormData = "multipart/form-data;"
+
+func (m *netHttpRequest) IsMultipartForm() bool {
+	return strings.HasPrefix(m.GetContentType(), gContentTypeMultipartFormData)
+}
+
+func (m *netHttpRequest) GetMultipartForm() (*httpServer.HttpMultiPartForm, error) {
+	if m.multiPartForm != nil {
+		return m.multiPartForm, nil
+	}
+
+	err := m.request.ParseMultipartForm(gMultipartFormMaxMemory)
+	if err != nil {
+		return nil, err
+	}
+
+	mpf := m.request.MultipartForm
+
+	var res = &httpServer.HttpMultiPartForm{
+		Values: mpf.Value,
+		Files:  mpf.File,
+	}
+
+	m.multiPartForm = res
+	return res, nil
+}
+
+func (m *netHttpRequest) Path() string {
+	return m.path
+}
+
+func (m *netHttpRequest) SetPath(path string) {
+	m.path = path
+}
+
+func (m *netHttpRequest) UserAgent() string {
+	return m.request.UserAgent()
+}
+
+func (m *netHttpRequest) RemoteIP() string {
+	ip, _, err := net.SplitHostPort(m.request.RemoteAddr)
+	if err != nil {
+		// Unix sockets have no IP.
+		return ""
+	}
+
+	return ip
+}
+
+func (m *netHttpRequest) GetClientCertificate() *httpServer.HttpClientCertificate {
+	return httpServer.NewHttpClientCertificate(m.request.TLS)
+}
+
+func (m *netHttpRequest) URI() httpServer.UriReader {
+	return m
+}
+
+func (m *netHttpRequest) FullURI() string {
+	return string(m.UriScheme()) + "://" + m.request.Host + m.GetOriginalPathAndQuery()
+}
+
+func (m *netHttpRequest) UriPath() []byte {
+	return []byte(m.path)
+}
+
+func (m *netHttpRequest) UriArgs(f func(key, value []byte)) {
+	m.GetQueryArgs().VisitAll(f)
+}
+
+func (m *netHttpRequest) UriQueryString() []byte {
+	return []byte(m.request.URL.RawQuery)
+}
+
+// UriScheme returns the scheme the request has been received with, which is "https" or "http".
+func (m *netHttpRequest) UriScheme() []byte {
+	if m.request.TLS != nil {
+		return gSchemeHttps
+	}
+
+	return gSchemeHttp
+}
+
+func (m *netHttpRequest) UriHost() []byte {
+	return []byte(m.request.Host)
+}
+
+func (m *netHttpRequest) GetHost() *httpServer.HttpHost {
+	return m.host
+}
+
+func (m *netHttpRequest) SetHost(host *httpServer.HttpHost) {
+	m.host = host
+}
+
+func (m *netHttpRequest) SetResolvedUrl(resolvedUrl httpServer.UrlResolverResult) {
+	m.resolvedUrl = resolvedUrl
+}
+
+func (m *netHttpRequest) GetResolvedUrl() httpServer.UrlResolverResult {
+	return m.resolvedUrl
+}
+
+func (m *netHttpRequest) IsTLS() bool {
+	return m.request.TLS != nil
+}
+
+func (m *netHttpRequest) GetTLSServerName() string {
+	if m.request.TLS == nil {
+		return ""
+	}
+
+	return m.request.TLS.ServerName
+}
+
+func (m *netHttpRequest) GetOriginalPathAndQuery() string {
+	return m.request.URL.RequestURI()
+}
+
+func (m *netHttpRequest) GetStatusCode() int {
+	return m.statusWriter.GetStatus()
+}
+
+func (m *netHttpRequest) GetBytesSent() int64 {
+	return m.statusWriter.bytesSent
+}
+
+func (m *netHttpRequest) GetAbortReason() error {
+	// The context is canceled when the client closes the connection.
+	return m.request.Context().Err()
+}
+
+func (m *netHttpRequest) CloseConnection() {
+	if m.isBodySend {
+		return
+	}
+
+	m.isBodySend = true
+	m.unlockMutex()
+
+	// It's the way net/http allows aborting the response and closing the connection.
+	panic(http.ErrAbortHandler)
+}
+
+func (m *netHttpRequest) Return500ErrorPage(err error) {
+	m.host.OnError(m, err)
+}
+
+func (m *netHttpRequest) WaitResponse() {
+	m.unlockMutex_.Lock()
+}
+
+func (m *netHttpRequest) Return404UnknownPage() {
+	m.host.OnNotFound(m)
+}
+
+func (m *netHttpRequest) unlockMutex() {
+	m.unlockMutex_.Unlock()
+}
+
+func (m *netHttpRequest) MustStop() bool {
+	return m.mustStop
+}
+
+func (m *netHttpRequest) StopRequest() {
+	m.mustStop = true
+}
+
+func (m *netHttpRequest) GetWildcards() []string {
+	return m.resolvedUrl.GetWildcards()
+}
+
+func (m *netHttpRequest) GetParam(name string) string {
+	return m.resolvedUrl.GetParam(name)
+}
+
+func (m *netHttpRequest) SendFile(filePath string) error {
+	if m.isBodySend {
+		return nil
+	}
+
+	defer m.unlockMutex()
+	m.isBodySend = true
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		m.writer.WriteHeader(http.StatusNotFound)
+		_, _ = io.WriteString(m.writer, "Cannot open requested path")
+		return nil
+	}
+
+	defer func() {
+		_ = file.Close()
+	}()
+
+	fileStat, err := file.Stat()
+	if (err != nil) || fileStat.IsDir() {
+		m.writer.WriteHeader(http.StatusNotFound)
+		_, _ = io.WriteString(m.writer, "Cannot open requested path")
+		return nil
+	}
+
+	// Manage "Range", "If-Modified-Since" and HEAD requests.
+	http.ServeContent(m.writer, m.request, fileStat.Name(), fileStat.ModTime(), file)
+	return nil
+}
+
+func (m *netHttpRequest) SendFileAsIs(filePath string, mimeType string, contentEncoding string) error {
+	if m.isBodySend {
+		return nil
+	}
+
+	fileStat, err := os.Stat(filePath)
+	if err != nil {
+		return errors.New("file not found")
+	}
+
+	if fileStat.IsDir() {
+		return errors.New("can't send a directory")
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return errors.New("file not found")
+	}
+
+	defer func() {
+		_ = file.Close()
+	}()
+
+	defer m.unlockMutex()
+	m.isBodySend = true
+
+	if mimeType == "" {
+		mimeType = mime.TypeByExtension(path.Ext(filePath))
+	}
+
+	hdr := m.writer.Header()
+
+	// Avoid ServeContent sniffing the content, which is wrong if it's compressed.
+	hdr.Set("Content-Type", mimeType)
+
+	if contentEncoding != "" {
+		hdr.Set("Content-Encoding", contentEncoding)
+	}
+
+	// Manage "Range", "If-Modified-Since" and HEAD requests.
+	http.ServeContent(m.writer, m.request, "", fileStat.ModTime(), file)
+	return nil
+}
+
+// gMultipartFormMaxMemory is the size of the multipart form kept in memory,
+// the remaining being stored in temporary files.
+const gMultipartFormMaxMemory = 1024 * 1024 * 4
+
+var gSchemeHttp = []byte("http")
+var gSchemeHttps = []byte("https")
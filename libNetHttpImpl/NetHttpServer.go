@@ -0,0 +1,248 @@
+package libNetHttpImpl
+
+import (
+	"context"
+	"github.com/progpjs/httpServer/v2"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// NetHttpServer is a server based on net/http. Unlike FastHttpServer
+// it supports HTTP/2, with https or without TLS (h2c).
+type NetHttpServer struct {
+	// lifecycle starts and stops the server.
+	lifecycle *httpServer.HttpServerLifecycle
+
+	// dispatcher contains the hosts and calls the handlers of the requests.
+	dispatcher *httpServer.HttpDispatcher
+}
+
+func NewNetHttpServer(port int) *NetHttpServer {
+	m := &NetHttpServer{}
+	m.dispatcher = httpServer.NewHttpDispatcher(m)
+	m.lifecycle = httpServer.NewHttpServerLifecycle(m, port, m.dispatcher, m.createEngine)
+	return m
+}
+
+func GetNetHttpServer(serverPort int) httpServer.HttpServer {
+	return GetNetHttpServerAt("", serverPort)
+}
+
+// GetNetHttpServerAt returns the server listening to this address and port,
+// creating it if needed. The address can be an IP or a listen address
+// as returned by StartParams.GetListenAddress.
+func GetNetHttpServerAt(bindAddress string, serverPort int) httpServer.HttpServer {
+	return httpServer.GetOrCreateHttpServerAt(bindAddress, serverPort, func(serverPort int) httpServer.HttpServer {
+		return NewNetHttpServer(serverPort)
+	})
+}
+
+func (m *NetHttpServer) GetPort() int {
+	return m.lifecycle.GetPort()
+}
+
+func (m *NetHttpServer) GetBindAddress() string {
+	return m.lifecycle.GetBindAddress()
+}
+
+func (m *NetHttpServer) IsStarted() bool {
+	return m.lifecycle.IsStarted()
+}
+
+func (m *NetHttpServer) Shutdown(timeout time.Duration) bool {
+	return m.lifecycle.Shutdown(timeout)
+}
+
+// StartServer starts the server and blocks until the server is stopped.
+func (m *NetHttpServer) StartServer() error {
+	return m.lifecycle.StartServer()
+}
+
+// Start starts the server without blocking. It returns once the socket
+// is listening, or returns the error if the socket can't be bound.
+func (m *NetHttpServer) Start() error {
+	return m.lifecycle.Start()
+}
+
+// Wait blocks until the server is stopped and returns the error
+// having stopped it, which is nil if stopped by Shutdown.
+func (m *NetHttpServer) Wait() error {
+	return m.lifecycle.Wait()
+}
+
+// Done returns a channel which is closed once the server is stopped.
+func (m *NetHttpServer) Done() <-chan struct{} {
+	return m.lifecycle.Done()
+}
+
+// netHttpEngine allows the lifecycle to use the net/http server.
+type netHttpEngine struct {
+	server     *http.Server
+	dispatcher *httpServer.HttpDispatcher
+
+	// maxRequestBodySize and serverName come from the params of the start,
+	// a new engine being created each time the server starts.
+	maxRequestBodySize int64
+	serverName         string
+}
+
+func (m *netHttpEngine) handleRequest(w http.ResponseWriter, r *http.Request) {
+	if m.serverName != "" {
+		w.Header().Set("Server", m.serverName)
+	}
+
+	if r.ContentLength > m.maxRequestBodySize {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// Reading more than the limit returns an error, when the size isn't known in advance.
+	r.Body = http.MaxBytesReader(w, r.Body, m.maxRequestBodySize)
+
+	req := prepareNetHttpRequest(w, r)
+	m.dispatcher.Dispatch(req, r.Host)
+}
+
+func (m *netHttpEngine) Serve(listener net.Listener) error {
+	// Returns http.ErrServerClosed once the server is shut down.
+	err := m.server.Serve(listener)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+
+	return err
+}
+
+func (m *netHttpEngine) Shutdown(ctx context.Context) error {
+	return m.server.Shutdown(ctx)
+}
+
+func (m *netHttpEngine) Close() {
+	_ = m.server.Close()
+}
+
+// createEngine creates and configures the net/http server, including his certificates.
+func (m *NetHttpServer) createEngine(params *httpServer.StartParams, certificates *httpServer.CertificateStore) (httpServer.HttpServerEngine, httpServer.HttpServerEngineOptions, error) {
+	engine := &netHttpEngine{dispatcher: m.dispatcher}
+
+	server := &http.Server{
+		Handler: http.HandlerFunc(engine.handleRequest),
+
+		// Limit to 10sec for receiving the complete request.
+		ReadTimeout: time.Second * 10,
+
+		WriteTimeout:   time.Second * time.Duration(params.WriteTimeoutInSec),
+		IdleTimeout:    time.Second * time.Duration(params.IdleTimeoutInSec),
+		MaxHeaderBytes: params.MaxHeaderSize,
+	}
+
+	if params.ReadTimeoutInSec > 0 {
+		server.ReadTimeout = time.Second * time.Duration(params.ReadTimeoutInSec)
+	}
+
+	if params.DisableKeepAlive {
+		server.SetKeepAlivesEnabled(false)
+	}
+
+	// Limit body size to 4Mo.
+	engine.maxRequestBodySize = 4 * 1024 * 1024
+
+	if params.MaxRequestBodySize > 0 {
+		engine.maxRequestBodySize = int64(params.MaxRequestBodySize)
+	}
+
+	if params.HideErrors {
+		// Do nothing, avoid saturating the console.
+		server.ErrorLog = log.New(io.Discard, "", 0)
+	}
+
+	if params.HideServerName {
+		engine.serverName = ""
+	} else if params.ServerName != "" {
+		engine.serverName = params.ServerName
+	} else {
+		// Use a fake server name for security, making less simple
+		// for hacker to known what server technologies is used.
+		engine.serverName = "Apache/2.4.38 (Debian)"
+	}
+
+	// net/http has no limit for the number of connections.
+	options := httpServer.HttpServerEngineOptions{LimitConnections: true}
+
+	if certificates != nil {
+		server.TLSConfig = certificates.TLSConfig()
+
+		// The protocols are selected in the server order, then "h2" must be first.
+		server.TLSConfig.NextProtos = append([]string{http2.NextProtoTLS}, server.TLSConfig.NextProtos...)
+	}
+
+	http2Server := &http2.Server{IdleTimeout: server.IdleTimeout}
+
+	// Enables HTTP/2 for the TLS connections.
+	err := http2.ConfigureServer(server, http2Server)
+	if err != nil {
+		return nil, options, err
+	}
+
+	if certificates != nil {
+		options.TLSConfig = server.TLSConfig
+	}
+
+	if params.EnableH2c {
+		// Allows the clients to use HTTP/2 without TLS, with prior knowledge
+		// or with an "Upgrade: h2c" header.
+		server.Handler = h2c.NewHandler(server.Handler, http2Server)
+	}
+
+	engine.server = server
+	return engine, options, nil
+}
+
+func (m *NetHttpServer) GetHost(hostName string) *httpServer.HttpHost {
+	return m.dispatcher.GetHost(hostName)
+}
+
+func (m *NetHttpServer) AddHostAlias(alias string, host *httpServer.HttpHost, redirectToHost bool) error {
+	return m.dispatcher.AddHostAlias(alias, host, redirectToHost)
+}
+
+func (m *NetHttpServer) SetDefaultHost(host *httpServer.HttpHost) {
+	m.dispatcher.SetDefaultHost(host)
+}
+
+func (m *NetHttpServer) SetUnknownHostHandler(handler httpServer.UnknownHostHandler) {
+	m.dispatcher.SetUnknownHostHandler(handler)
+}
+
+func (m *NetHttpServer) GetCertificateStore() *httpServer.CertificateStore {
+	return m.lifecycle.GetCertificateStore()
+}
+
+func (m *NetHttpServer) GetLogger() *log.Logger {
+	return m.dispatcher.GetLogger()
+}
+
+func (m *NetHttpServer) SetLogger(logger *log.Logger) {
+	m.dispatcher.SetLogger(logger)
+}
+
+func (m *NetHttpServer) SetPanicHandler(handler httpServer.PanicHandler) {
+	m.dispatcher.SetPanicHandler(handler)
+}
+
+func (m *NetHttpServer) SetRequestHooks(hooks *httpServer.HttpRequestHooks) {
+	m.dispatcher.SetRequestHooks(hooks)
+}
+
+func (m *NetHttpServer) GetRequestHooks() *httpServer.HttpRequestHooks {
+	return m.dispatcher.GetRequestHooks()
+}
+
+func (m *NetHttpServer) SetStartServerParams(params httpServer.StartParams) {
+	m.lifecycle.SetStartServerParams(params)
+}
@@ -0,0 +1,1204 @@
+package libNetHttpImpl
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/progpjs/httpServer/v2"
+	"golang.org/x/net/http2"
+	"html/template"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStartAndShutdown(test *testing.T) {
+	server := NewNetHttpServer(8191)
+	httpServer.RegisterServer(server)
+
+	server.GetHost("localhost").GET("/hello/w*", func(call httpServer.HttpRequest) error {
+		cookie, _ := call.GetCookie("name")
+		count := call.GetQueryArgs().GetUintOrZero("count")
+
+		call.ReturnString(200, "hello w"+call.GetWildcards()[0]+" "+cookie["value"].(string)+" "+strings.Repeat("!", count))
+		return nil
+	})
+
+	err := server.Start()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// The port is already used, the error must be returned immediately.
+	other := NewNetHttpServer(8191)
+	if other.Start() == nil {
+		test.Error("Binding an used port must fail")
+	}
+
+	req, _ := http.NewRequest("GET", "http://localhost:8191/hello/world?count=3", nil)
+	req.AddCookie(&http.Cookie{Name: "name", Value: "cookie"})
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	body, _ := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+
+	if string(body) != "hello world cookie !!!" {
+		test.Error("Invalid response [", string(body), "]")
+	}
+
+	res, err = http.Get("http://localhost:8191/unknown")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	_ = res.Body.Close()
+
+	if res.StatusCode != 404 {
+		test.Error("Unknown page must return a 404, status is", res.StatusCode)
+	}
+
+	if !server.Shutdown(time.Second) {
+		test.Error("Shutdown must succeed when there is no pending request")
+	}
+
+	if server.Wait() != nil {
+		test.Error("Wait must return nil after a shutdown")
+	}
+
+	if GetNetHttpServer(8191) == server {
+		test.Error("A new server instance was expected")
+	}
+}
+
+func TestHttp2(test *testing.T) {
+	caFilePath := path.Join(test.TempDir(), "ca.pem")
+	server := NewNetHttpServer(8192)
+
+	server.SetStartServerParams(httpServer.StartParams{
+		DevCertificates: &httpServer.DevCertificatesParams{
+			Hostnames:    []string{"localhost"},
+			ExportCaFile: caFilePath,
+		},
+	})
+
+	server.GetHost("localhost").GET("/", func(call httpServer.HttpRequest) error {
+		call.ReturnString(200, string(call.URI().UriScheme()))
+		return nil
+	})
+
+	err := server.Start()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	defer server.Shutdown(time.Second)
+
+	caPem, err := os.ReadFile(caFilePath)
+	if err != nil {
+		test.Fatal("The CA must be exported:", err)
+	}
+
+	err = AddFetchTrustedCaPem(caPem)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	res, err := Fetch("https://localhost:8192/", "GET", FetchOptions{})
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	defer res.Dispose()
+
+	body, _ := res.GetBodyAsString()
+	if body != "https" {
+		test.Error("Invalid response [", body, "]")
+	}
+
+	proto := res.(*fetchResultImpl).resp.ProtoMajor
+	if proto != 2 {
+		test.Error("HTTP/2 expected, found HTTP/", proto)
+	}
+}
+
+func TestH2c(test *testing.T) {
+	server := NewNetHttpServer(8193)
+	server.SetStartServerParams(httpServer.StartParams{EnableH2c: true})
+
+	server.GetHost("localhost").POST("/", func(call httpServer.HttpRequest) error {
+		call.ReturnString(200, call.GetMethodName())
+		return nil
+	})
+
+	err := server.Start()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	defer server.Shutdown(time.Second)
+
+	// HTTP/2 with prior knowledge, without TLS.
+	client := &http.Client{
+		Transport: &http2.Transport{
+			AllowHTTP: true,
+
+			DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, network, addr)
+			},
+		},
+	}
+
+	res, err := client.Post("http://localhost:8193/", "text/plain", strings.NewReader("body"))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	body, _ := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+
+	if res.ProtoMajor != 2 {
+		test.Error("HTTP/2 expected, found HTTP/", res.ProtoMajor)
+	}
+
+	if string(body) != "POST" {
+		test.Error("Invalid response [", string(body), "]")
+	}
+}
+
+func TestFileServer(test *testing.T) {
+	dir := test.TempDir()
+	content := strings.Repeat("<p>hello</p>", 100)
+
+	err := os.WriteFile(path.Join(dir, "index.html"), []byte(content), 0600)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	server := NewNetHttpServer(8194)
+
+	fileServer, err := NewFileServer("/static", dir, StaticFileServerOptions{})
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	fileServer.Register(server.GetHost("localhost"))
+
+	err = server.Start()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	defer server.Shutdown(time.Second)
+
+	// The client asks for gzip and uncompress the body.
+	res, err := http.Get("http://localhost:8194/static/index.html")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	body, _ := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+
+	if string(body) != content {
+		test.Error("Invalid response [", string(body), "]")
+	}
+
+	if !res.Uncompressed {
+		test.Error("The gzip version must be sent")
+	}
+
+	if !strings.HasPrefix(res.Header.Get("Content-Type"), "text/html") {
+		test.Error("Invalid content type [", res.Header.Get("Content-Type"), "]")
+	}
+
+	res, err = http.Get("http://localhost:8194/static/unknown.html")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	_ = res.Body.Close()
+
+	if res.StatusCode != 404 {
+		test.Error("Unknown file must return a 404, status is", res.StatusCode)
+	}
+}
+
+func TestHostAliases(test *testing.T) {
+	server := NewNetHttpServer(8195)
+	host := server.GetHost("localhost")
+
+	host.GET("/", func(call httpServer.HttpRequest) error {
+		call.ReturnString(200, call.GetHost().GetHostName())
+		return nil
+	})
+
+	if err := host.AddAlias("127.0.0.1", false); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := host.AddAlias("alias.localhost", true); err != nil {
+		test.Fatal(err)
+	}
+
+	err := server.Start()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	defer server.Shutdown(time.Second)
+
+	res, err := http.Get("http://127.0.0.1:8195/")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	body, _ := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+
+	if string(body) != "localhost" {
+		test.Error("Invalid response [", string(body), "]")
+	}
+
+	req, _ := http.NewRequest("GET", "http://127.0.0.1:8195/?a=b", nil)
+	req.Host = "alias.localhost:8195"
+
+	res, err = http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	_ = res.Body.Close()
+
+	if location := res.Header.Get("Location"); location != "http://localhost:8195/?a=b" {
+		test.Error("Invalid redirect [", location, "]")
+	}
+}
+
+type syncBuffer struct {
+	buffer bytes.Buffer
+	mutex  sync.Mutex
+}
+
+func (m *syncBuffer) Write(p []byte) (int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.buffer.Write(p)
+}
+
+func (m *syncBuffer) String() string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.buffer.String()
+}
+
+func TestErrorHandlers(test *testing.T) {
+	server := NewNetHttpServer(8196)
+	host := server.GetHost("localhost")
+
+	logs := &syncBuffer{}
+	server.SetLogger(log.New(logs, "", 0))
+
+	host.GET("/fail", func(call httpServer.HttpRequest) error {
+		return errors.New("secret")
+	})
+
+	tpl := template.Must(template.New("error").Parse("<h1>{{.Status}} {{.Message}}</h1>"))
+	host.SetErrorHandler(httpServer.NewProblemDetailsErrorHandler(httpServer.NewTemplateErrorHandler(tpl)))
+
+	notFoundFilePath := path.Join(test.TempDir(), "404.html")
+	_ = os.WriteFile(notFoundFilePath, []byte("<h1>Not here</h1>"), 0600)
+
+	notFoundHandler, err := httpServer.NewFileErrorHandler(notFoundFilePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	host.SetNotFoundHandler(notFoundHandler)
+
+	err = server.Start()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	defer server.Shutdown(time.Second)
+
+	res, body := httpGetWithAccept(test, "http://localhost:8196/fail", "text/html")
+	if (res.StatusCode != 500) || (body != "<h1>500 Internal Server Error</h1>") {
+		test.Error("Invalid HTML error [", res.StatusCode, body, "]")
+	}
+
+	res, body = httpGetWithAccept(test, "http://localhost:8196/fail", "application/json, text/plain;q=0.5")
+
+	var problem map[string]any
+	_ = json.Unmarshal([]byte(body), &problem)
+
+	if (res.Header.Get("Content-Type") != "application/problem+json") || (problem["status"] != float64(500)) ||
+		(problem["instance"] != "/fail") || strings.Contains(body, "secret") {
+		test.Error("Invalid JSON error [", body, "]")
+	}
+
+	if !strings.Contains(logs.String(), "secret") {
+		test.Error("The error must be logged, found [", logs.String(), "]")
+	}
+
+	res, body = httpGetWithAccept(test, "http://localhost:8196/unknown", "text/html")
+	if (res.StatusCode != 404) || (body != "<h1>Not here</h1>") || !strings.HasPrefix(res.Header.Get("Content-Type"), "text/html") {
+		test.Error("Invalid not found page [", res.StatusCode, body, "]")
+	}
+}
+
+func TestHttpErrors(test *testing.T) {
+	server := NewNetHttpServer(8197)
+	host := server.GetHost("localhost")
+
+	logs := &syncBuffer{}
+	server.SetLogger(log.New(logs, "", 0))
+
+	host.GET("/private", func(call httpServer.HttpRequest) error {
+		return httpServer.NewUnauthorizedError("login required").WithHeader("WWW-Authenticate", "Basic")
+	})
+
+	host.GET("/wrapped", func(call httpServer.HttpRequest) error {
+		cause := errors.New("duplicate key")
+		return fmt.Errorf("saving: %w", httpServer.NewConflictError("").WithCause(cause))
+	})
+
+	host.GET("/invalid", func(call httpServer.HttpRequest) error {
+		return httpServer.NewUnprocessableEntityError("the name is required")
+	})
+
+	err := server.Start()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	defer server.Shutdown(time.Second)
+
+	res, body := httpGetWithAccept(test, "http://localhost:8197/private", "")
+	if (res.StatusCode != 401) || (body != "login required") || (res.Header.Get("WWW-Authenticate") != "Basic") {
+		test.Error("Invalid 401 response [", res.StatusCode, body, "]")
+	}
+
+	res, body = httpGetWithAccept(test, "http://localhost:8197/wrapped", "")
+	if (res.StatusCode != 409) || (body != "Conflict") {
+		test.Error("Invalid 409 response [", res.StatusCode, body, "]")
+	}
+
+	host.SetErrorHandler(httpServer.NewProblemDetailsErrorHandler(nil))
+
+	res, body = httpGetWithAccept(test, "http://localhost:8197/invalid", "application/json")
+
+	var problem map[string]any
+	_ = json.Unmarshal([]byte(body), &problem)
+
+	if (res.StatusCode != 422) || (problem["status"] != float64(422)) || (problem["detail"] != "the name is required") {
+		test.Error("Invalid 422 response [", res.StatusCode, body, "]")
+	}
+
+	if logs.String() != "" {
+		test.Error("Client errors must not be logged, found [", logs.String(), "]")
+	}
+}
+
+func httpGetWithAccept(test *testing.T, url string, accept string) (*http.Response, string) {
+	req, _ := http.NewRequest("GET", url, nil)
+
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	body, _ := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+
+	return res, string(body)
+}
+
+func TestPanicRecovery(test *testing.T) {
+	server := NewNetHttpServer(8198)
+	host := server.GetHost("localhost")
+
+	var panics []*httpServer.HttpPanicInfo
+	var panicsMutex sync.Mutex
+
+	server.SetPanicHandler(func(req httpServer.HttpRequest, info *httpServer.HttpPanicInfo) {
+		panicsMutex.Lock()
+		defer panicsMutex.Unlock()
+
+		panics = append(panics, info)
+	})
+
+	host.GET("/user/*", func(call httpServer.HttpRequest) error {
+		panic("boom")
+	})
+
+	fileServer, err := NewFileServer("/static", test.TempDir(), StaticFileServerOptions{
+		Hooks: &httpServer.FileServerHooks{
+			RewriteCacheKey: func(call httpServer.HttpRequest) string {
+				panic("file server boom")
+			},
+		},
+	})
+
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	fileServer.Register(host)
+
+	err = server.Start()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	defer server.Shutdown(time.Second)
+
+	req, _ := http.NewRequest("GET", "http://localhost:8198/user/john", nil)
+	req.Header.Set("X-Request-Id", "my-request")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	_ = res.Body.Close()
+
+	if (res.StatusCode != 500) || (res.Header.Get("X-Request-Id") != "my-request") {
+		test.Error("Invalid response after a panic [", res.StatusCode, "]")
+	}
+
+	res, _ = httpGetWithAccept(test, "http://localhost:8198/static/index.html", "")
+	if (res.StatusCode != 500) || (len(res.Header.Get("X-Request-Id")) != 16) {
+		test.Error("Invalid response after a file server panic [", res.StatusCode, "]")
+	}
+
+	panicsMutex.Lock()
+	defer panicsMutex.Unlock()
+
+	if len(panics) != 2 {
+		test.Fatal("The panics must be reported, found [", len(panics), "]")
+	}
+
+	if (panics[0].Value != "boom") || (panics[0].RoutePattern != "/user/*") || (panics[0].RequestId != "my-request") ||
+		!strings.Contains(string(panics[0].Stack), "TestPanicRecovery") {
+		test.Error("Invalid panic info [", panics[0].Value, panics[0].RoutePattern, panics[0].RequestId, "]")
+	}
+
+	if (panics[1].Value != "file server boom") || (panics[1].RoutePattern != "/static/*") {
+		test.Error("Invalid file server panic info [", panics[1].Value, panics[1].RoutePattern, "]")
+	}
+}
+
+func TestMethodNotAllowed(test *testing.T) {
+	server := NewNetHttpServer(8199)
+	host := server.GetHost("localhost")
+
+	handler := func(call httpServer.HttpRequest) error {
+		call.ReturnString(200, call.GetMethodName())
+		return nil
+	}
+
+	host.GET("/item", handler)
+	host.PUT("/item", handler)
+	host.GET("/explicit", handler)
+	host.OPTIONS("/explicit", handler)
+
+	err := server.Start()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	defer server.Shutdown(time.Second)
+
+	do := func(method string, url string) (*http.Response, string) {
+		req, _ := http.NewRequest(method, url, nil)
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		body, _ := io.ReadAll(res.Body)
+		_ = res.Body.Close()
+
+		return res, string(body)
+	}
+
+	res, _ := do("POST", "http://localhost:8199/item")
+	if (res.StatusCode != 405) || (res.Header.Get("Allow") != "GET, HEAD, PUT, OPTIONS") {
+		test.Error("Invalid 405 response [", res.StatusCode, res.Header.Get("Allow"), "]")
+	}
+
+	res, _ = do("OPTIONS", "http://localhost:8199/item")
+	if (res.StatusCode != 204) || (res.Header.Get("Allow") != "GET, HEAD, PUT, OPTIONS") {
+		test.Error("Invalid OPTIONS response [", res.StatusCode, res.Header.Get("Allow"), "]")
+	}
+
+	res, body := do("OPTIONS", "http://localhost:8199/explicit")
+	if (res.StatusCode != 200) || (body != "OPTIONS") {
+		test.Error("The explicit OPTIONS route must be used [", res.StatusCode, body, "]")
+	}
+
+	res, _ = do("POST", "http://localhost:8199/unknown")
+	if res.StatusCode != 404 {
+		test.Error("An unknown path must return 404 [", res.StatusCode, "]")
+	}
+
+	res, _ = do("OPTIONS", "http://localhost:8199/unknown")
+	if res.StatusCode != 404 {
+		test.Error("OPTIONS on an unknown path must return 404 [", res.StatusCode, "]")
+	}
+}
+
+func TestHeadFallback(test *testing.T) {
+	server := NewNetHttpServer(8200)
+	host := server.GetHost("localhost")
+
+	host.GET("/page", func(call httpServer.HttpRequest) error {
+		call.SetHeader("X-Is-Head", strconv.FormatBool(call.IsHead()))
+		call.ReturnString(200, "hello world")
+		return nil
+	})
+
+	err := server.Start()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	defer server.Shutdown(time.Second)
+
+	res, err := http.Head("http://localhost:8200/page")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	body, _ := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+
+	if (res.StatusCode != 200) || (res.ContentLength != 11) || (len(body) != 0) || (res.Header.Get("X-Is-Head") != "true") {
+		test.Error("Invalid HEAD response [", res.StatusCode, res.ContentLength, string(body), "]")
+	}
+}
+
+func TestHostMiddlewares(test *testing.T) {
+	server := NewNetHttpServer(8201)
+	host := server.GetHost("localhost")
+
+	var statuses []string
+	var statusesMutex sync.Mutex
+
+	host.OnResponse(func(call httpServer.HttpRequest, status int) {
+		statusesMutex.Lock()
+		defer statusesMutex.Unlock()
+
+		statuses = append(statuses, call.Path()+":"+strconv.Itoa(status))
+	})
+
+	host.Use(func(call httpServer.HttpRequest) error {
+		call.SetHeader("X-Host-Wide", "yes")
+
+		if call.Path() == "/old" {
+			call.SetPath("/new")
+		}
+
+		return nil
+	}, func(call httpServer.HttpRequest) error {
+		if call.Path() == "/blocked" {
+			call.ReturnString(403, "blocked")
+		}
+
+		return nil
+	})
+
+	host.GET("/new", func(call httpServer.HttpRequest) error {
+		call.ReturnString(200, "new")
+		return nil
+	})
+
+	host.GET("/blocked", func(call httpServer.HttpRequest) error {
+		test.Error("The request must be stopped by the middleware")
+		return nil
+	})
+
+	err := server.Start()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	defer server.Shutdown(time.Second)
+
+	res, body := httpGetWithAccept(test, "http://localhost:8201/old", "")
+	if (res.StatusCode != 200) || (body != "new") || (res.Header.Get("X-Host-Wide") != "yes") {
+		test.Error("The path must be rewritten [", res.StatusCode, body, "]")
+	}
+
+	res, _ = httpGetWithAccept(test, "http://localhost:8201/unknown", "")
+	if (res.StatusCode != 404) || (res.Header.Get("X-Host-Wide") != "yes") {
+		test.Error("The middlewares must be called when no route matches [", res.StatusCode, "]")
+	}
+
+	res, body = httpGetWithAccept(test, "http://localhost:8201/blocked", "")
+	if (res.StatusCode != 403) || (body != "blocked") {
+		test.Error("The request must be stopped [", res.StatusCode, body, "]")
+	}
+
+	statusesMutex.Lock()
+	defer statusesMutex.Unlock()
+
+	if strings.Join(statuses, " ") != "/new:200 /unknown:404 /blocked:403" {
+		test.Error("Invalid statuses [", statuses, "]")
+	}
+}
+
+type hooksRecorder struct {
+	events []string
+	mutex  sync.Mutex
+}
+
+func (m *hooksRecorder) add(event string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.events = append(m.events, event)
+}
+
+func (m *hooksRecorder) reset() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.events = nil
+}
+
+func (m *hooksRecorder) String() string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return strings.Join(m.events, " ")
+}
+
+func (m *hooksRecorder) hooks() *httpServer.HttpRequestHooks {
+	return &httpServer.HttpRequestHooks{
+		OnRequestStart: func(req httpServer.HttpRequest) {
+			m.add("start:" + req.Path())
+		},
+
+		OnRouteMatched: func(req httpServer.HttpRequest, pattern string, tag any) {
+			m.add("route:" + pattern)
+		},
+
+		OnResponseCommitted: func(req httpServer.HttpRequest, response httpServer.HttpResponseInfo) {
+			m.add("committed:" + strconv.Itoa(response.Status) + ":" + strconv.FormatInt(response.BytesSent, 10))
+		},
+
+		OnRequestFinished: func(req httpServer.HttpRequest, response httpServer.HttpResponseInfo) {
+			if response.Duration <= 0 {
+				m.add("invalid duration")
+			}
+
+			m.add("finished")
+		},
+
+		OnRequestAborted: func(req httpServer.HttpRequest, reason error) {
+			m.add("aborted")
+		},
+	}
+}
+
+func TestRequestHooks(test *testing.T) {
+	backend := NewNetHttpServer(8203)
+
+	backend.GetHost("localhost").GET("/proxied", func(call httpServer.HttpRequest) error {
+		call.ReturnString(200, "from backend")
+		return nil
+	})
+
+	err := backend.Start()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	defer backend.Shutdown(time.Second)
+
+	server := NewNetHttpServer(8202)
+	host := server.GetHost("localhost")
+
+	recorder := &hooksRecorder{}
+	server.SetRequestHooks(recorder.hooks())
+
+	host.GET("/hello", func(call httpServer.HttpRequest) error {
+		call.ReturnString(200, "hello")
+		return nil
+	})
+
+	host.GET("/close", func(call httpServer.HttpRequest) error {
+		call.(httpServer.HttpRoutableRequest).CloseConnection()
+		return nil
+	})
+
+	dir := test.TempDir()
+	_ = os.WriteFile(path.Join(dir, "file.txt"), []byte("file content"), 0600)
+
+	fileServer, err := NewFileServer("/static", dir, StaticFileServerOptions{})
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	fileServer.Register(host)
+
+	proxy, err := BuildProxyAsIsMiddleware("http://localhost:8203", 5)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	host.GET("/proxied", proxy)
+
+	err = server.Start()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	defer server.Shutdown(time.Second)
+
+	// Without keep-alive, the client doesn't retry when the connection is closed.
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true, DisableKeepAlives: true}}
+
+	expect := func(url string, expected string) {
+		recorder.reset()
+
+		res, err := client.Get(url)
+		if err == nil {
+			_, _ = io.ReadAll(res.Body)
+			_ = res.Body.Close()
+		}
+
+		// The hooks can be called after the client receives the response.
+		for i := 0; (i < 100) && !strings.HasSuffix(recorder.String(), expected[strings.LastIndex(expected, " ")+1:]); i++ {
+			time.Sleep(time.Millisecond * 10)
+		}
+
+		if recorder.String() != expected {
+			test.Error("Invalid hooks for [", url, "], found [", recorder.String(), "] expected [", expected, "]")
+		}
+	}
+
+	expect("http://localhost:8202/hello", "start:/hello route:/hello committed:200:5 finished")
+	expect("http://localhost:8202/unknown", "start:/unknown committed:404:9 finished")
+	expect("http://localhost:8202/static/file.txt", "start:/static/file.txt route:/static/* committed:200:12 finished")
+	expect("http://localhost:8202/proxied", "start:/proxied route:/proxied committed:200:12 finished")
+	expect("http://localhost:8202/close", "start:/close route:/close aborted")
+}
+
+func TestNamedParams(test *testing.T) {
+	server := NewNetHttpServer(8204)
+
+	server.GetHost("localhost").GET("/users/{id:int}/posts/:slug", func(call httpServer.HttpRequest) error {
+		call.ReturnString(200, call.GetParam("id")+":"+call.GetParam("slug"))
+		return nil
+	})
+
+	err := server.Start()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	defer server.Shutdown(time.Second)
+
+	res, body := httpGetWithAccept(test, "http://localhost:8204/users/12/posts/hello", "")
+	if (res.StatusCode != 200) || (body != "12:hello") {
+		test.Error("Invalid params [", res.StatusCode, body, "]")
+	}
+
+	res, _ = httpGetWithAccept(test, "http://localhost:8204/users/john/posts/hello", "")
+	if res.StatusCode != 404 {
+		test.Error("The constraint must be checked [", res.StatusCode, "]")
+	}
+}
+
+func TestRouteGroups(test *testing.T) {
+	server := NewNetHttpServer(8205)
+	host := server.GetHost("localhost")
+
+	api := host.Group("/api/:version")
+
+	api.Use(func(call httpServer.HttpRequest) error {
+		call.SetHeader("X-Api-Version", call.GetParam("version"))
+		return nil
+	})
+
+	users := api.Group("users")
+
+	users.Use(func(call httpServer.HttpRequest) error {
+		if call.GetHeaders()["Authorization"] == "" {
+			return httpServer.NewUnauthorizedError("")
+		}
+
+		return nil
+	})
+
+	users.GET("/:id", func(call httpServer.HttpRequest) error {
+		call.ReturnString(200, call.Path()+" "+call.GetParam("version")+" "+call.GetParam("id"))
+		return nil
+	})
+
+	api.GET("/", func(call httpServer.HttpRequest) error {
+		call.ReturnString(200, "api root "+call.Path())
+		return nil
+	})
+
+	module := httpServer.NewHttpHost("", nil, nil)
+
+	module.Use(func(call httpServer.HttpRequest) error {
+		call.SetHeader("X-Module", "yes")
+		return nil
+	})
+
+	module.GET("/", func(call httpServer.HttpRequest) error {
+		call.ReturnString(200, "module home")
+		return nil
+	})
+
+	module.GET("/files/f*", func(call httpServer.HttpRequest) error {
+		call.ReturnString(200, call.Path()+" "+strings.Join(call.GetWildcards(), ","))
+		return nil
+	})
+
+	module.GET("/tenant", func(call httpServer.HttpRequest) error {
+		call.ReturnString(200, "tenant "+call.GetParam("tenant"))
+		return nil
+	})
+
+	host.Mount("/admin", module)
+	host.Group("/tenants/:tenant").Mount("/backoffice", module)
+
+	err := server.Start()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	defer server.Shutdown(time.Second)
+
+	get := func(url string, authorization string) (*http.Response, string) {
+		req, _ := http.NewRequest("GET", url, nil)
+
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		body, _ := io.ReadAll(res.Body)
+		_ = res.Body.Close()
+
+		return res, string(body)
+	}
+
+	res, body := get("http://localhost:8205/api/v2/users/12", "Bearer token")
+	if (res.StatusCode != 200) || (body != "/12 v2 12") || (res.Header.Get("X-Api-Version") != "v2") {
+		test.Error("Invalid group response [", res.StatusCode, body, "]")
+	}
+
+	res, _ = get("http://localhost:8205/api/v2/users/12", "")
+	if (res.StatusCode != 401) || (res.Header.Get("X-Api-Version") != "v2") {
+		test.Error("The middlewares of the group must be called [", res.StatusCode, "]")
+	}
+
+	res, body = get("http://localhost:8205/api/v1", "")
+	if (res.StatusCode != 200) || (body != "api root /") {
+		test.Error("Invalid group root [", res.StatusCode, body, "]")
+	}
+
+	for _, prefix := range []string{"/admin", "/tenants/acme/backoffice"} {
+		res, body = get("http://localhost:8205"+prefix, "")
+		if (res.StatusCode != 200) || (body != "module home") || (res.Header.Get("X-Module") != "yes") {
+			test.Error("Invalid mounted home for [", prefix, "] [", res.StatusCode, body, "]")
+		}
+
+		res, body = get("http://localhost:8205"+prefix+"/files/file1", "")
+		if (res.StatusCode != 200) || (body != "/files/file1 ile1") {
+			test.Error("Invalid mounted route for [", prefix, "] [", res.StatusCode, body, "]")
+		}
+
+		res, _ = get("http://localhost:8205"+prefix+"/unknown", "")
+		if res.StatusCode != 404 {
+			test.Error("Invalid mounted unknown route for [", prefix, "] [", res.StatusCode, "]")
+		}
+	}
+
+	res, body = get("http://localhost:8205/tenants/acme/backoffice/tenant", "")
+	if (res.StatusCode != 200) || (body != "tenant acme") {
+		test.Error("The params of the prefix must be available to the mounted host [", res.StatusCode, body, "]")
+	}
+}
+
+func TestRoutingPolicy(test *testing.T) {
+	dir := test.TempDir()
+
+	err := os.MkdirAll(path.Join(dir, "docs"), 0700)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	err = os.WriteFile(path.Join(dir, "docs", "index.html"), []byte("docs index"), 0600)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	server := NewNetHttpServer(8206)
+	host := server.GetHost("localhost")
+
+	host.GET("/Docs/:page", func(call httpServer.HttpRequest) error {
+		call.ReturnString(200, "page "+call.GetParam("page"))
+		return nil
+	})
+
+	host.GET("/about/", func(call httpServer.HttpRequest) error {
+		call.ReturnString(200, "about")
+		return nil
+	})
+
+	host.POST("/orders", func(call httpServer.HttpRequest) error {
+		call.ReturnString(200, "orders")
+		return nil
+	})
+
+	host.GET("/assets/*", func(call httpServer.HttpRequest) error {
+		call.ReturnString(200, "assets")
+		return nil
+	})
+
+	fileServer, err := NewFileServer("/static/", dir, StaticFileServerOptions{})
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	fileServer.Register(host)
+
+	err = server.Start()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	defer server.Shutdown(time.Second)
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	call := func(method string, url string) (*http.Response, string) {
+		req, _ := http.NewRequest(method, "http://localhost:8206"+url, nil)
+
+		res, err := client.Do(req)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		body, _ := io.ReadAll(res.Body)
+		_ = res.Body.Close()
+
+		return res, string(body)
+	}
+
+	expect := func(method string, url string, status int, expected string) {
+		res, body := call(method, url)
+
+		if (res.StatusCode != status) || ((expected != "") && (body != expected) &&
+			(res.Header.Get("Location") != expected) && (res.Header.Get("Allow") != expected)) {
+			test.Error("Invalid response for [", method, url, "] [", res.StatusCode, body, res.Header.Get("Location"), res.Header.Get("Allow"), "]")
+		}
+	}
+
+	// Strict is the default.
+	expect("GET", "/about", 404, "")
+	expect("GET", "/docs/intro", 404, "")
+	expect("GET", "/assets/", 404, "")
+
+	host.SetRoutingPolicy(httpServer.HttpRoutingPolicy{
+		TrailingSlash:   httpServer.TrailingSlashRedirect,
+		CaseInsensitive: true,
+	})
+
+	expect("GET", "/about?a=1", 301, "/about/?a=1")
+
+	// The scheme and the host of an absolute-form request aren't part of the path.
+	res := sendAbsoluteFormRequest(test, "localhost:8206", "http://localhost:8206/about/")
+	if res.StatusCode != 200 {
+		test.Error("Invalid status for an absolute-form request [", res.StatusCode, res.Header.Get("Location"), "]")
+	}
+
+	res = sendAbsoluteFormRequest(test, "localhost:8206", "http://localhost:8206/about?a=1")
+	if location := res.Header.Get("Location"); (res.StatusCode != 301) || (location != "/about/?a=1") {
+		test.Error("Invalid redirection of an absolute-form request [", res.StatusCode, location, "]")
+	}
+
+	expect("POST", "/orders/", 308, "/orders")
+	expect("GET", "//about/", 301, "/about/")
+	expect("GET", "/DOCS/Intro", 200, "page Intro")
+	expect("GET", "/static/docs?v=2", 301, "/static/docs/?v=2")
+	expect("GET", "/static/docs/", 200, "docs index")
+	expect("GET", "/unknown", 404, "")
+
+	// The allowed methods are searched with the same policy.
+	expect("POST", "/DOCS/Intro", 405, "")
+	expect("POST", "/about", 405, "")
+	expect("OPTIONS", "/ABOUT", 204, "GET, HEAD, OPTIONS")
+
+	host.SetRoutingPolicy(httpServer.HttpRoutingPolicy{TrailingSlash: httpServer.TrailingSlashMatchBoth})
+
+	expect("GET", "/about", 200, "about")
+	expect("GET", "/about/", 200, "about")
+	expect("POST", "/orders/", 200, "orders")
+	expect("GET", "/assets/", 200, "assets")
+	expect("GET", "/static/docs", 200, "docs index")
+	expect("GET", "/docs/intro", 404, "")
+	expect("POST", "/about", 405, "")
+	expect("POST", "/assets/", 405, "")
+}
+
+func TestMountedRoutingPolicy(test *testing.T) {
+	server := NewNetHttpServer(8207)
+	host := server.GetHost("localhost")
+
+	host.SetNotFoundHandler(func(call httpServer.HttpRequest, status int, err error) {
+		call.ReturnString(404, "host not found")
+	})
+
+	var matchedPattern string
+	var matchedPatternMutex sync.Mutex
+
+	server.SetRequestHooks(&httpServer.HttpRequestHooks{
+		OnRouteMatched: func(req httpServer.HttpRequest, pattern string, tag any) {
+			matchedPatternMutex.Lock()
+			defer matchedPatternMutex.Unlock()
+			matchedPattern = pattern
+		},
+	})
+
+	module := httpServer.NewHttpHost("", nil, nil)
+
+	module.SetRoutingPolicy(httpServer.HttpRoutingPolicy{
+		TrailingSlash:   httpServer.TrailingSlashRedirect,
+		CaseInsensitive: true,
+	})
+
+	module.GET("/about/", func(call httpServer.HttpRequest) error {
+		call.ReturnString(200, "about")
+		return nil
+	})
+
+	module.POST("/orders", func(call httpServer.HttpRequest) error {
+		call.ReturnString(200, "orders")
+		return nil
+	})
+
+	host.Mount("/shop", module)
+
+	err := server.Start()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	defer server.Shutdown(time.Second)
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	call := func(method string, url string) (*http.Response, string) {
+		req, _ := http.NewRequest(method, "http://localhost:8207"+url, nil)
+
+		res, err := client.Do(req)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		body, _ := io.ReadAll(res.Body)
+		_ = res.Body.Close()
+
+		return res, string(body)
+	}
+
+	res, _ := call("GET", "/shop/about?a=1")
+	if (res.StatusCode != 301) || (res.Header.Get("Location") != "/shop/about/?a=1") {
+		test.Error("The routing policy of the mounted host must be used [", res.StatusCode, res.Header.Get("Location"), "]")
+	}
+
+	res, body := call("GET", "/shop/ABOUT/")
+	if (res.StatusCode != 200) || (body != "about") {
+		test.Error("Invalid case insensitive mounted route [", res.StatusCode, body, "]")
+	}
+
+	matchedPatternMutex.Lock()
+	if matchedPattern != "/shop/about/" {
+		test.Error("OnRouteMatched must receive the pattern of the mounted route [", matchedPattern, "]")
+	}
+	matchedPatternMutex.Unlock()
+
+	res, _ = call("GET", "/shop/orders")
+	if (res.StatusCode != 405) || (res.Header.Get("Allow") != "POST, OPTIONS") {
+		test.Error("Invalid mounted method not allowed [", res.StatusCode, res.Header.Get("Allow"), "]")
+	}
+
+	res, _ = call("OPTIONS", "/shop/orders")
+	if (res.StatusCode != 204) || (res.Header.Get("Allow") != "POST, OPTIONS") {
+		test.Error("Invalid mounted OPTIONS [", res.StatusCode, res.Header.Get("Allow"), "]")
+	}
+
+	res, body = call("GET", "/shop/unknown")
+	if (res.StatusCode != 404) || (body != "host not found") {
+		test.Error("The not found handler of the host must be used [", res.StatusCode, body, "]")
+	}
+}
+
+// sendAbsoluteFormRequest sends a GET request whose target contains the scheme and the host,
+// like a client talking to a proxy does. Go's http client can't send it to a server.
+func sendAbsoluteFormRequest(test *testing.T, address string, target string) *http.Response {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	_, err = fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: %s\r\nConnection: close\r\n\r\n", target, address)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	_, _ = io.ReadAll(res.Body)
+	_ = res.Body.Close()
+
+	return res
+}
@@ -0,0 +1,302 @@
+package libNetHttpImpl
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"github.com/progpjs/httpServer/v2"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+var gFetchHttpClient *http.Client
+var gFetchHttpClientMutex sync.Mutex
+
+// gFetchRootCAs are the CA trusted by Fetch. If nil, the system CA are used.
+var gFetchRootCAs *x509.CertPool
+
+// AddFetchTrustedCaPem allows Fetch to trust the certificates signed by these CA certificates,
+// in addition to the system CA. It's mainly used with the development certificates.
+func AddFetchTrustedCaPem(caPem []byte) error {
+	gFetchHttpClientMutex.Lock()
+	defer gFetchHttpClientMutex.Unlock()
+
+	// The current client can be doing handshakes with the pool,
+	// which is why the certificates are added to a copy.
+	var pool *x509.CertPool
+
+	if gFetchRootCAs == nil {
+		systemPool, err := x509.SystemCertPool()
+		if err != nil {
+			systemPool = x509.NewCertPool()
+		}
+
+		pool = systemPool
+	} else {
+		pool = gFetchRootCAs.Clone()
+	}
+
+	if !pool.AppendCertsFromPEM(caPem) {
+		return errors.New("no certificate found")
+	}
+
+	gFetchRootCAs = pool
+
+	// Force the client to be rebuilt with the new CA.
+	gFetchHttpClient = nil
+	return nil
+}
+
+func initFetchHttpClient() {
+	gFetchHttpClientMutex.Lock()
+	defer gFetchHttpClientMutex.Unlock()
+
+	if gFetchHttpClient != nil {
+		return
+	}
+
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+
+		DialContext: (&net.Dialer{
+			Timeout:   time.Second * 30,
+			KeepAlive: time.Second * 30,
+		}).DialContext,
+
+		// Allows HTTP/2 with https.
+		ForceAttemptHTTP2: true,
+
+		// It's avoid to wait an infinite time
+		// while allowing time for long processing requests.
+		//
+		ResponseHeaderTimeout: time.Minute * 3,
+
+		IdleConnTimeout:     time.Hour * 1,
+		MaxIdleConnsPerHost: 64,
+	}
+
+	if gFetchRootCAs != nil {
+		transport.TLSClientConfig = &tls.Config{RootCAs: gFetchRootCAs}
+	}
+
+	gFetchHttpClient = &http.Client{
+		Transport: transport,
+
+		// Like libFastHttpImpl, redirects aren't followed.
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func Fetch(url string, methodName string, options FetchOptions) (httpServer.FetchResult, error) {
+	initFetchHttpClient()
+
+	gFetchHttpClientMutex.Lock()
+	client := gFetchHttpClient
+	gFetchHttpClientMutex.Unlock()
+
+	// Set the request body if exists.
+	// Allows to send POST data for example.
+	//
+	var body io.Reader
+
+	if options.BodyStreamWriter != nil {
+		pipeReader, pipeWriter := io.Pipe()
+		body = pipeReader
+
+		go func() {
+			w := bufio.NewWriter(pipeWriter)
+			options.BodyStreamWriter(w)
+			_ = pipeWriter.CloseWithError(w.Flush())
+		}()
+	} else if options.Body != nil {
+		body = bytes.NewReader(options.Body)
+	}
+
+	req, err := http.NewRequest(methodName, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.ContentType != "" {
+		req.Header.Set("Content-Type", options.ContentType)
+	}
+
+	if options.UserAgent != "" {
+		req.Header.Set("User-Agent", options.UserAgent)
+	} else {
+		// Avoid sending the default User-Agent which is "Go-http-client".
+		req.Header.Set("User-Agent", "")
+	}
+
+	if options.SendHeaders != nil {
+		for k, v := range options.SendHeaders {
+			req.Header.Set(k, v)
+		}
+	}
+
+	if options.SendCookies != nil {
+		for k, v := range options.SendCookies {
+			req.AddCookie(&http.Cookie{Name: k, Value: v})
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &fetchResultImpl{resp: resp}
+
+	if options.SkipBody {
+		res.Dispose()
+	}
+
+	return res, nil
+}
+
+type FetchOptions struct {
+	SendHeaders map[string]string
+	SendCookies map[string]string
+	SkipBody    bool
+
+	UserAgent        string
+	ContentType      string
+	Body             []byte
+	BodyStreamWriter func(w *bufio.Writer)
+}
+
+type fetchResultImpl struct {
+	resp *http.Response
+	body []byte
+
+	// isBodyRead is true once the body is read and closed.
+	isBodyRead bool
+}
+
+func (m *fetchResultImpl) StatusCode() int {
+	return m.resp.StatusCode
+}
+
+func (m *fetchResultImpl) StreamBodyToFile(filePath string) error {
+	if m.isBodyRead {
+		return errors.New("the body is already read")
+	}
+
+	_ = os.MkdirAll(path.Dir(filePath), os.ModePerm)
+
+	fileH, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = fileH.Close()
+	}()
+
+	m.isBodyRead = true
+
+	defer func() {
+		_ = m.resp.Body.Close()
+	}()
+
+	_, err = io.Copy(fileH, m.resp.Body)
+	return err
+}
+
+func (m *fetchResultImpl) Dispose() {
+	if !m.isBodyRead {
+		m.isBodyRead = true
+		_ = m.resp.Body.Close()
+	}
+}
+
+// GetBody returns the body, uncompressed if the server has compressed it.
+func (m *fetchResultImpl) GetBody() ([]byte, error) {
+	if m.isBodyRead {
+		return m.body, nil
+	}
+
+	m.isBodyRead = true
+
+	defer func() {
+		_ = m.resp.Body.Close()
+	}()
+
+	var reader io.Reader = m.resp.Body
+
+	// The transport only uncompress the body if he has asked for a compressed body.
+	if m.resp.Header.Get("Content-Encoding") == "gzip" {
+		gzipReader, err := gzip.NewReader(m.resp.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		reader = gzipReader
+	}
+
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	m.body = body
+	return body, nil
+}
+
+func (m *fetchResultImpl) GetBodyAsString() (string, error) {
+	b, err := m.GetBody()
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+func (m *fetchResultImpl) GetContentLength() int {
+	return int(m.resp.ContentLength)
+}
+
+func (m *fetchResultImpl) GetHeaders() map[string]string {
+	res := make(map[string]string)
+
+	for key, values := range m.resp.Header {
+		if len(values) != 0 {
+			res[key] = values[0]
+		}
+	}
+
+	return res
+}
+
+func (m *fetchResultImpl) GetContentType() string {
+	return m.resp.Header.Get("Content-Type")
+}
+
+func (m *fetchResultImpl) GetCookies() (map[string]map[string]any, error) {
+	res := make(map[string]map[string]any)
+
+	for _, c := range m.resp.Cookies() {
+		res[c.Name] = cookieToJson(c)
+	}
+
+	return res, nil
+}
+
+func (m *fetchResultImpl) GetCookie(name string) (map[string]any, error) {
+	for _, c := range m.resp.Cookies() {
+		if c.Name == name {
+			return cookieToJson(c), nil
+		}
+	}
+
+	return nil, nil
+}
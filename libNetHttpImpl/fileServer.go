@@ -0,0 +1,475 @@
+package libNetHttpImpl
+
+import (
+	"compress/gzip"
+	"errors"
+	"github.com/progpjs/httpServer/v2"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+//region netFileServer
+
+type netFileServer struct {
+	byURI map[string]*netFileServerEntry
+	mutex sync.RWMutex
+
+	baseDir  string
+	basePath string
+
+	hooks *httpServer.FileServerHooks
+
+	fileCount    int
+	maxFileCount int
+}
+
+func newNetFileServer(basePath string, baseDir string, options StaticFileServerOptions) *netFileServer {
+	m := &netFileServer{
+		basePath: basePath,
+		baseDir:  baseDir,
+		byURI:    make(map[string]*netFileServerEntry),
+		hooks:    options.Hooks,
+	}
+
+	if m.hooks == nil {
+		m.hooks = &httpServer.FileServerHooks{}
+	}
+	return m
+}
+
+func (m *netFileServer) Register(host *httpServer.HttpHost) {
+	mdw := func(call httpServer.HttpRequest) error {
+		isFound, err := m.handleRequest(call)
+
+		if isFound {
+			if err != nil {
+				return err
+			}
+
+			return nil
+		}
+
+		call.Return404UnknownPage()
+		return nil
+	}
+
+	basePath := m.basePath
+
+	host.GET(basePath, mdw)
+	host.HEAD(basePath, mdw)
+
+	if basePath[len(basePath)-1] != '/' {
+		basePath += "/*"
+	} else {
+		basePath += "*"
+	}
+
+	host.GET(basePath, mdw)
+	host.HEAD(basePath, mdw)
+}
+
+func (m *netFileServer) Dispose() {
+}
+
+func (m *netFileServer) GetHooks() *httpServer.FileServerHooks {
+	return m.hooks
+}
+
+func (m *netFileServer) VisitCache(f func(entry httpServer.FileServerCacheEntry)) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	for _, entry := range m.byURI {
+		f(entry)
+	}
+}
+
+func (m *netFileServer) RemoveAll() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	oldCache := m.byURI
+	m.byURI = make(map[string]*netFileServerEntry)
+
+	if m.hooks.OnRemoveCacheItem == nil {
+		for _, cacheEntry := range oldCache {
+			if cacheEntry.gzipFilePath != "" {
+				_ = os.Remove(cacheEntry.gzipFilePath)
+			}
+		}
+	} else {
+		for _, cacheEntry := range oldCache {
+			m.hooks.OnRemoveCacheItem(cacheEntry, "")
+		}
+	}
+}
+
+func (m *netFileServer) RemoveExactUri(uri string, selectData string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var toRemove []string
+
+	for cacheKey, entry := range m.byURI {
+		if entry.uri == uri {
+			toRemove = append(toRemove, cacheKey)
+		}
+	}
+
+	if m.hooks.OnRemoveCacheItem == nil {
+		for _, key := range toRemove {
+			cacheEntry := m.byURI[key]
+			if cacheEntry.gzipFilePath != "" {
+				_ = os.Remove(cacheEntry.gzipFilePath)
+			}
+
+			delete(m.byURI, key)
+		}
+	} else {
+		for _, key := range toRemove {
+			// Here selectData allows to filter what to remove exactly.
+			if m.hooks.OnRemoveCacheItem(m.byURI[key], selectData) {
+				delete(m.byURI, key)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *netFileServer) handleRequest(call httpServer.HttpRequest) (bool, error) {
+	var cacheKey string
+
+	if m.hooks.RewriteCacheKey != nil {
+		cacheKey = m.hooks.RewriteCacheKey(call)
+	} else {
+		cacheKey = string(call.URI().UriPath())
+	}
+
+	m.mutex.RLock()
+	cacheEntry := m.byURI[cacheKey]
+	m.mutex.RUnlock()
+
+	if cacheEntry != nil {
+		cacheEntry.counter++
+
+		err := m.sendFile(call, cacheEntry)
+		if err != nil {
+			return false, err
+		}
+
+		return true, nil
+	}
+
+	baseDir := m.baseDir
+
+	if m.hooks.RewriteBaseDir != nil {
+		baseDir = m.hooks.RewriteBaseDir(call, baseDir)
+	}
+
+	filePath := call.Path()
+
+	if filePath == "" {
+		filePath = "/index.html"
+	} else if filePath[len(filePath)-1] == '/' {
+		filePath += "index.html"
+	} else if m.isDirectory(baseDir, filePath) {
+		// A directory requested without trailing slash follows the routing policy of the host.
+		switch call.GetHost().GetRoutingPolicy().TrailingSlash {
+		case httpServer.TrailingSlashRedirect:
+			httpServer.RedirectWithTrailingSlash(call)
+			return true, nil
+		case httpServer.TrailingSlashMatchBoth:
+			filePath += "/index.html"
+		}
+	}
+
+	filePath = path.Join(baseDir, filePath[len(m.basePath):])
+	if !strings.HasPrefix(filePath, baseDir) {
+		return false, errors.New("invalid cacheKey")
+	}
+
+	var err error
+	cacheEntry, err = m.addFileToCache(call, cacheKey, filePath)
+	if err != nil {
+		return false, err
+	}
+
+	if cacheEntry == nil {
+		return false, nil
+	}
+
+	err = m.sendFile(call, cacheEntry)
+	if err != nil {
+		return true, err
+	}
+
+	return true, nil
+}
+
+// isDirectory returns true if the path of the request designs a directory inside baseDir.
+func (m *netFileServer) isDirectory(baseDir string, filePath string) bool {
+	relPath := ""
+	if len(filePath) > len(m.basePath) {
+		relPath = filePath[len(m.basePath):]
+	}
+
+	dirPath := path.Join(baseDir, relPath)
+	if !strings.HasPrefix(dirPath, baseDir) {
+		return false
+	}
+
+	stat, err := os.Stat(dirPath)
+	return (err == nil) && stat.IsDir()
+}
+
+func (m *netFileServer) sendFile(call httpServer.HttpRequest, cacheEntry *netFileServerEntry) error {
+	netRequest := call.(*netHttpRequest)
+	cacheEntry.lastRequestedDate = time.Now()
+
+	filePath := cacheEntry.filePath
+	hdr := netRequest.writer.Header()
+
+	// Only send the compressed version if the client supports it.
+	if (cacheEntry.gzipFilePath != "") && strings.Contains(netRequest.request.Header.Get("Accept-Encoding"), "gzip") {
+		filePath = cacheEntry.gzipFilePath
+		hdr.Set("Content-Encoding", "gzip")
+	}
+
+	hdr.Add("Vary", "Accept-Encoding")
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = file.Close()
+	}()
+
+	defer netRequest.unlockMutex()
+	netRequest.isBodySend = true
+
+	hdr.Set("Content-Type", cacheEntry.contentType)
+
+	// Manage "Range", "If-Modified-Since" and HEAD requests.
+	http.ServeContent(netRequest.writer, netRequest.request, "", cacheEntry.fileUpdateDate, file)
+
+	return nil
+}
+
+func (m *netFileServer) addFileToCache(call httpServer.HttpRequest, cacheKey string, filePath string) (*netFileServerEntry, error) {
+	var data string
+	if m.hooks.CalcCacheEntryData != nil {
+		data = m.hooks.CalcCacheEntryData(call)
+	}
+
+	fileStat, err := os.Stat(filePath)
+	if err != nil {
+		if m.hooks.OnFileNotFound != nil {
+			err = m.hooks.OnFileNotFound(call, filePath, data)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		fileStat, err = os.Stat(filePath)
+
+		if err != nil {
+			return nil, nil
+		}
+	}
+
+	if fileStat.IsDir() {
+		return nil, errors.New("can't send a directory")
+	}
+
+	contentLength := int(fileStat.Size())
+	mimeType := mime.TypeByExtension(path.Ext(filePath))
+
+	cacheEntry := &netFileServerEntry{
+		counter:        1,
+		data:           data,
+		uri:            call.FullURI(),
+		filePath:       filePath,
+		contentType:    mimeType,
+		contentLength:  contentLength,
+		fileUpdateDate: fileStat.ModTime(),
+	}
+
+	m.mutex.Lock()
+	m.byURI[cacheKey] = cacheEntry
+	counter := m.fileCount
+	m.fileCount++
+
+	if (counter > m.maxFileCount) && (m.hooks.OnTooMuchFiles != nil) {
+		m.hooks.OnTooMuchFiles(m)
+	}
+
+	m.mutex.Unlock()
+
+	gzipFilePath := filePath + ".gzip"
+
+	if contentLength < gDontCompressOverSize {
+		// We always rebuild the gzip version in order to prevent errors
+		// where the gzip version is ko.
+		//
+		err = GzipCompressFile(filePath, gzipFilePath, gzip.BestCompression)
+
+		// Try again after a pause.
+		//
+		if err != nil {
+			time.Sleep(time.Millisecond * 250)
+			err = GzipCompressFile(filePath, gzipFilePath, gzip.BestCompression)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		var stat os.FileInfo
+		stat, err = os.Stat(gzipFilePath)
+		if err != nil {
+			return nil, err
+		}
+
+		cacheEntry.gzipFilePath = gzipFilePath
+		cacheEntry.gzipContentLength = int(stat.Size())
+	}
+
+	return cacheEntry, nil
+}
+
+//endregion
+
+//region netFileServerEntry
+
+type netFileServerEntry struct {
+	counter int
+
+	uri           string
+	filePath      string
+	contentLength int
+
+	gzipFilePath      string
+	gzipContentLength int
+
+	contentType       string
+	fileUpdateDate    time.Time
+	lastRequestedDate time.Time
+
+	// Allow to set data to a cache entry in order to seperated two entry
+	// with the same uri. For example on entry for a special user and another for
+	// other users.
+	data string
+}
+
+func (m *netFileServerEntry) GetHitCount() int {
+	return m.counter
+}
+
+func (m *netFileServerEntry) GetFilePath() string {
+	return m.filePath
+}
+
+func (m *netFileServerEntry) GetContentType() string {
+	return m.contentType
+}
+
+func (m *netFileServerEntry) GetContentLength() int {
+	return m.contentLength
+}
+
+func (m *netFileServerEntry) GetGzipContentLength() int {
+	return m.gzipContentLength
+}
+
+func (m *netFileServerEntry) GetGzipFilePath() string {
+	return m.gzipFilePath
+}
+
+func (m *netFileServerEntry) GetFullUri() string {
+	return m.uri
+}
+
+func (m *netFileServerEntry) GetData() string {
+	return m.data
+}
+
+func (m *netFileServerEntry) GetFileUpdateDate() time.Time {
+	return m.fileUpdateDate
+}
+
+func (m *netFileServerEntry) GetLastRequestedDate() time.Time {
+	return m.lastRequestedDate
+}
+
+//endregion
+
+func NewFileServer(basePath string, baseDir string, options StaticFileServerOptions) (httpServer.FileServer, error) {
+	baseDir = path.Clean(baseDir)
+
+	if strings.HasPrefix(baseDir, "~") {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return nil, errors.New("invalid dir path")
+		}
+
+		baseDir = path.Join(homeDir, baseDir[1:])
+	}
+
+	stat, err := os.Stat(baseDir)
+	if err != nil {
+		return nil, errors.New("invalid dir path")
+	}
+
+	if !stat.IsDir() {
+		return nil, errors.New("invalid dir path")
+	}
+
+	return newNetFileServer(basePath, baseDir, options), nil
+}
+
+type StaticFileServerOptions struct {
+	Hooks *httpServer.FileServerHooks
+}
+
+func GzipCompressFile(sourceFile, destFile string, compressionLevel int) error {
+	sourceFileH, err := os.Open(sourceFile)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = sourceFileH.Close()
+	}()
+
+	destFileH, err := os.Create(destFile)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = destFileH.Close()
+	}()
+
+	writer, err := gzip.NewWriterLevel(destFileH, compressionLevel)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(writer, sourceFileH)
+	if err != nil {
+		_ = writer.Close()
+		return err
+	}
+
+	return writer.Close()
+}
+
+const gDontCompressOverSize = 1024 * 1024 * 50 // 50Mo
@@ -0,0 +1,22 @@
+package libNetHttpImpl
+
+import (
+	"github.com/progpjs/httpServer/v2"
+	"net/http"
+)
+
+// cookieToJson returns the cookie with the same format as libFastHttpImpl.
+func cookieToJson(c *http.Cookie) map[string]any {
+	out := make(map[string]any)
+
+	out["key"] = c.Name
+	out["domain"] = c.Domain
+	out["value"] = c.Value
+	out["maxAge"] = c.MaxAge
+	out["expireTime"] = c.Expires.Unix()
+	out["sameSiteType"] = httpServer.CookieSameSite(c.SameSite)
+	out["isSecure"] = c.Secure
+	out["isHTTPOnly"] = c.HttpOnly
+
+	return out
+}
@@ -0,0 +1,58 @@
+package libNetHttpImpl
+
+import (
+	"github.com/progpjs/httpServer/v2"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"time"
+)
+
+// BuildProxyAsIsMiddleware returns a middleware allowing to proxy a request as-is.
+// Here there is not path translation.
+func BuildProxyAsIsMiddleware(targetHostName string, timeOutInSec int64) (httpServer.HttpMiddleware, error) {
+	target, err := url.Parse(targetHostName)
+	if err != nil {
+		return nil, err
+	}
+
+	if target.Scheme == "" {
+		target.Scheme = "http"
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = time.Second * (time.Duration)(timeOutInSec)
+
+	return func(call httpServer.HttpRequest) error {
+		// Here we will reuse the current request.
+		netCall := call.(*netHttpRequest)
+
+		var proxyError error
+
+		proxy := &httputil.ReverseProxy{
+			Transport: transport,
+
+			Director: func(req *http.Request) {
+				req.URL.Scheme = target.Scheme
+				req.URL.Host = target.Host
+				req.Host = target.Host
+			},
+
+			// Nothing is sent yet, the error is returned to the host.
+			ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+				proxyError = err
+			},
+		}
+
+		proxy.ServeHTTP(netCall.writer, netCall.request)
+
+		if proxyError != nil {
+			return proxyError
+		}
+
+		netCall.isBodySend = true
+		netCall.unlockMutex()
+
+		return nil
+	}, nil
+}
@@ -0,0 +1,72 @@
+package libNetHttpImpl
+
+import (
+	"io"
+	"net/http"
+)
+
+// statusWriter is a http.ResponseWriter keeping the status and the size of the response.
+type statusWriter struct {
+	http.ResponseWriter
+	status    int
+	bytesSent int64
+}
+
+func (m *statusWriter) WriteHeader(status int) {
+	if m.status == 0 {
+		m.status = status
+	}
+
+	m.ResponseWriter.WriteHeader(status)
+}
+
+func (m *statusWriter) Write(b []byte) (int, error) {
+	if m.status == 0 {
+		m.status = http.StatusOK
+	}
+
+	n, err := m.ResponseWriter.Write(b)
+	m.bytesSent += int64(n)
+
+	return n, err
+}
+
+// ReadFrom allows http.ServeContent to use sendfile, like without this writer.
+func (m *statusWriter) ReadFrom(src io.Reader) (int64, error) {
+	if m.status == 0 {
+		m.status = http.StatusOK
+	}
+
+	var n int64
+	var err error
+
+	if readerFrom, ok := m.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = readerFrom.ReadFrom(src)
+	} else {
+		n, err = io.Copy(struct{ io.Writer }{m.ResponseWriter}, src)
+	}
+
+	m.bytesSent += n
+	return n, err
+}
+
+// GetStatus returns the status sent, which is 200 if nothing is sent.
+func (m *statusWriter) GetStatus() int {
+	if m.status == 0 {
+		return http.StatusOK
+	}
+
+	return m.status
+}
+
+// Flush allows streaming the response, which is used by the proxy.
+func (m *statusWriter) Flush() {
+	if flusher, ok := m.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap allows http.ResponseController to find the original writer.
+func (m *statusWriter) Unwrap() http.ResponseWriter {
+	return m.ResponseWriter
+}
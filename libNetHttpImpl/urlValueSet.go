@@ -0,0 +1,118 @@
+package libNetHttpImpl
+
+import (
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+// urlValueSet implements httpServer.ValueSet for the query string and the posted form values.
+type urlValueSet struct {
+	values      url.Values
+	queryString string
+}
+
+func newUrlValueSet(values url.Values, queryString string) *urlValueSet {
+	return &urlValueSet{values: values, queryString: queryString}
+}
+
+func (m *urlValueSet) Len() int {
+	count := 0
+
+	for _, values := range m.values {
+		count += len(values)
+	}
+
+	return count
+}
+
+func (m *urlValueSet) QueryString() []byte {
+	return []byte(m.queryString)
+}
+
+// VisitAll calls the function for each value, sorted by key.
+func (m *urlValueSet) VisitAll(f func(key, value []byte)) {
+	keys := make([]string, 0, len(m.values))
+
+	for key := range m.values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		for _, value := range m.values[key] {
+			f([]byte(key), []byte(value))
+		}
+	}
+}
+
+func (m *urlValueSet) Has(key string) bool {
+	return m.values.Has(key)
+}
+
+func (m *urlValueSet) GetUfloat(key string) (float64, error) {
+	if !m.values.Has(key) {
+		return -1, gErrNoArgValue
+	}
+
+	value, err := strconv.ParseFloat(m.values.Get(key), 64)
+	if err != nil {
+		return -1, err
+	}
+
+	if value < 0 {
+		return -1, gErrUnexpectedNegative
+	}
+
+	return value, nil
+}
+
+func (m *urlValueSet) GetUfloatOrZero(key string) float64 {
+	value, err := m.GetUfloat(key)
+	if err != nil {
+		return 0
+	}
+
+	return value
+}
+
+func (m *urlValueSet) GetUint(key string) (int, error) {
+	if !m.values.Has(key) {
+		return -1, gErrNoArgValue
+	}
+
+	value, err := strconv.Atoi(m.values.Get(key))
+	if err != nil {
+		return -1, err
+	}
+
+	if value < 0 {
+		return -1, gErrUnexpectedNegative
+	}
+
+	return value, nil
+}
+
+func (m *urlValueSet) GetUintOrZero(key string) int {
+	value, err := m.GetUint(key)
+	if err != nil {
+		return 0
+	}
+
+	return value
+}
+
+// GetBool returns true for the values "1", "t", "true", "y", "yes" and "on".
+func (m *urlValueSet) GetBool(key string) bool {
+	switch m.values.Get(key) {
+	case "1", "t", "true", "y", "yes", "on":
+		return true
+	default:
+		return false
+	}
+}
+
+var gErrNoArgValue = errors.New("no args value for the given key")
+var gErrUnexpectedNegative = errors.New("unexpected negative number")
@@ -0,0 +1,142 @@
+/*
+ * (C) Copyright 2024 Johan Michel PIQUET, France (https://johanpiquet.fr/).
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpServer
+
+import (
+	"net"
+	"sync"
+)
+
+// limitedListener limits the number of connections, in total and for each client IP.
+// It allows the implementations without such limits, like net/http,
+// to support StartParams.MaxConcurrency and StartParams.MaxConnsPerIP.
+type limitedListener struct {
+	net.Listener
+
+	// slots is full when the max number of connections is reached.
+	// It's nil when there is no limit.
+	slots chan struct{}
+
+	maxConnsPerIP int
+	connsByIP     map[string]int
+	mutex         sync.Mutex
+}
+
+// newLimitedListener returns the listener itself if there is no limit.
+func newLimitedListener(listener net.Listener, maxConns int, maxConnsPerIP int) net.Listener {
+	if (maxConns <= 0) && (maxConnsPerIP <= 0) {
+		return listener
+	}
+
+	m := &limitedListener{
+		Listener:      listener,
+		maxConnsPerIP: maxConnsPerIP,
+		connsByIP:     make(map[string]int),
+	}
+
+	if maxConns > 0 {
+		m.slots = make(chan struct{}, maxConns)
+	}
+
+	return m
+}
+
+func (m *limitedListener) Accept() (net.Conn, error) {
+	for {
+		// Wait until a connection is closed.
+		if m.slots != nil {
+			m.slots <- struct{}{}
+		}
+
+		conn, err := m.Listener.Accept()
+		if err != nil {
+			m.releaseSlot()
+			return nil, err
+		}
+
+		ip := remoteIP(conn)
+
+		if m.acquireIP(ip) {
+			return &limitedConn{Conn: conn, listener: m, ip: ip}, nil
+		}
+
+		// Too many connections for this client.
+		_ = conn.Close()
+		m.releaseSlot()
+	}
+}
+
+func (m *limitedListener) acquireIP(ip string) bool {
+	if (m.maxConnsPerIP <= 0) || (ip == "") {
+		return true
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.connsByIP[ip] >= m.maxConnsPerIP {
+		return false
+	}
+
+	m.connsByIP[ip]++
+	return true
+}
+
+func (m *limitedListener) release(ip string) {
+	if (m.maxConnsPerIP > 0) && (ip != "") {
+		m.mutex.Lock()
+
+		m.connsByIP[ip]--
+		if m.connsByIP[ip] <= 0 {
+			delete(m.connsByIP, ip)
+		}
+
+		m.mutex.Unlock()
+	}
+
+	m.releaseSlot()
+}
+
+func (m *limitedListener) releaseSlot() {
+	if m.slots != nil {
+		<-m.slots
+	}
+}
+
+type limitedConn struct {
+	net.Conn
+
+	listener  *limitedListener
+	ip        string
+	closeOnce sync.Once
+}
+
+func (m *limitedConn) Close() error {
+	err := m.Conn.Close()
+	m.closeOnce.Do(func() { m.listener.release(m.ip) })
+	return err
+}
+
+// remoteIP returns the IP of the client, or an empty string for unix sockets.
+func remoteIP(conn net.Conn) string {
+	addr, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if ok {
+		return addr.IP.String()
+	}
+
+	return ""
+}
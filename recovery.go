@@ -0,0 +1,114 @@
+/*
+ * (C) Copyright 2024 Johan Michel PIQUET, France (https://johanpiquet.fr/).
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpServer
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+// PanicError is the error sent to the host error handler when a middleware panics.
+type PanicError struct {
+	Value any
+}
+
+func (m *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", m.Value)
+}
+
+// HttpPanicInfo describes a panic which occurred while processing a request.
+type HttpPanicInfo struct {
+	// Value is the value given to panic.
+	Value any
+
+	Stack []byte
+
+	// RoutePattern is the path of the route matching the request, for example "/user/*".
+	// It's empty if the panic occurs before the route is found.
+	RoutePattern string
+
+	// RequestId is the value of the "X-Request-Id" header, or a generated id.
+	// It's also sent with the response, allowing to find the log entry.
+	RequestId string
+}
+
+// PanicHandler is called when a panic occurs while processing a request.
+// The response is sent after, with a 500 error, by the host error handler.
+type PanicHandler func(req HttpRequest, info *HttpPanicInfo)
+
+// RequestIdHeader is the header containing the id of a request.
+const RequestIdHeader = "X-Request-Id"
+
+// SetPanicHandler sets the function called when a request panics.
+// Default is writing the panic and his stack to the logger.
+func (m *HttpDispatcher) SetPanicHandler(handler PanicHandler) {
+	m.hostsMutex.Lock()
+	defer m.hostsMutex.Unlock()
+
+	m.panicHandler = handler
+}
+
+// recoverPanic must be called with defer. It reports the panic and sends a 500 error.
+// The pattern function returns the pattern of the route, which is known only once the route is found.
+func (m *HttpDispatcher) recoverPanic(req HttpRoutableRequest, pattern func() string) {
+	value := recover()
+	if value == nil {
+		return
+	}
+
+	// It's how net/http aborts a response, his server manages it.
+	if value == http.ErrAbortHandler {
+		panic(value)
+	}
+
+	info := &HttpPanicInfo{
+		Value:        value,
+		Stack:        debug.Stack(),
+		RoutePattern: pattern(),
+		RequestId:    getRequestId(req),
+	}
+
+	m.hostsMutex.RLock()
+	handler := m.panicHandler
+	m.hostsMutex.RUnlock()
+
+	if handler != nil {
+		handler(req, info)
+	} else {
+		m.GetLogger().Printf("panic on %s %s%s (route %q, request %s): %v\n%s",
+			req.GetMethodName(), req.URI().UriHost(), req.Path(), info.RoutePattern, info.RequestId, value, info.Stack)
+	}
+
+	req.SetHeader(RequestIdHeader, info.RequestId)
+	req.GetHost().OnError(req, &PanicError{Value: value})
+}
+
+// getRequestId returns the value of the "X-Request-Id" header, or a new random id.
+func getRequestId(req HttpRequest) string {
+	requestId := req.GetHeaders()[RequestIdHeader]
+	if requestId != "" {
+		return requestId
+	}
+
+	buffer := make([]byte, 8)
+	_, _ = rand.Read(buffer)
+
+	return hex.EncodeToString(buffer)
+}
@@ -0,0 +1,136 @@
+/*
+ * (C) Copyright 2024 Johan Michel PIQUET, France (https://johanpiquet.fr/).
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpServer
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+type HttpRequestStartHookF func(req HttpRequest)
+type HttpRouteMatchedHookF func(req HttpRequest, pattern string, tag any)
+type HttpResponseCommittedHookF func(req HttpRequest, response HttpResponseInfo)
+type HttpRequestFinishedHookF func(req HttpRequest, response HttpResponseInfo)
+type HttpRequestAbortedHookF func(req HttpRequest, reason error)
+
+// HttpRequestHooks allows observing all the requests of a server, for example for metrics.
+// They are called for the routes, the file servers and the proxies. Each hook is optional.
+type HttpRequestHooks struct {
+	// OnRequestStart is called when the request is received, before searching his host.
+	OnRequestStart HttpRequestStartHookF
+
+	// OnRouteMatched is called once the route is found, with his pattern and the tag given when adding it.
+	OnRouteMatched HttpRouteMatchedHookF
+
+	// OnResponseCommitted is called once the handlers have written the response.
+	OnResponseCommitted HttpResponseCommittedHookF
+
+	// OnRequestFinished is called at the end, after the response hooks of the host.
+	OnRequestFinished HttpRequestFinishedHookF
+
+	// OnRequestAborted is called instead of OnResponseCommitted and OnRequestFinished
+	// when the connection is closed without sending a complete response.
+	OnRequestAborted HttpRequestAbortedHookF
+}
+
+// HttpResponseInfo describes the response sent.
+type HttpResponseInfo struct {
+	Status int
+
+	// BytesSent is the size of the body.
+	BytesSent int64
+
+	// Duration is the time elapsed since the request has been received.
+	Duration time.Duration
+}
+
+// ErrConnectionClosed is the reason given when the connection is closed with HttpRoutableRequest.CloseConnection.
+var ErrConnectionClosed = errors.New("connection closed")
+
+// SetRequestHooks sets the hooks called for all the requests. Nil removes them.
+func (m *HttpDispatcher) SetRequestHooks(hooks *HttpRequestHooks) {
+	if hooks == nil {
+		m.requestHooks.Store(nil)
+		return
+	}
+
+	copied := *hooks
+	m.requestHooks.Store(&copied)
+}
+
+// GetRequestHooks returns the hooks set with SetRequestHooks, or nil.
+func (m *HttpDispatcher) GetRequestHooks() *HttpRequestHooks {
+	return m.requestHooks.Load()
+}
+
+// endRequest must be called with defer once the request is dispatched.
+// It calls the hooks of the request end, and the response hooks of the host.
+func (m *HttpDispatcher) endRequest(req HttpRoutableRequest, host *HttpHost, hooks *HttpRequestHooks, startTime time.Time) {
+	// Only http.ErrAbortHandler isn't recovered when dispatching, since net/http manages it.
+	if value := recover(); value != nil {
+		if (hooks != nil) && (hooks.OnRequestAborted != nil) {
+			reason, isError := value.(error)
+			if !isError {
+				reason = fmt.Errorf("%v", value)
+			}
+
+			m.callHook("OnRequestAborted", func() { hooks.OnRequestAborted(req, reason) })
+		}
+
+		panic(value)
+	}
+
+	if reason := req.GetAbortReason(); reason != nil {
+		if (hooks != nil) && (hooks.OnRequestAborted != nil) {
+			m.callHook("OnRequestAborted", func() { hooks.OnRequestAborted(req, reason) })
+		}
+
+		return
+	}
+
+	response := HttpResponseInfo{
+		Status:    req.GetStatusCode(),
+		BytesSent: req.GetBytesSent(),
+		Duration:  time.Since(startTime),
+	}
+
+	if (hooks != nil) && (hooks.OnResponseCommitted != nil) {
+		m.callHook("OnResponseCommitted", func() { hooks.OnResponseCommitted(req, response) })
+	}
+
+	if host != nil {
+		m.callResponseHooks(req, host)
+	}
+
+	if (hooks != nil) && (hooks.OnRequestFinished != nil) {
+		response.Duration = time.Since(startTime)
+		m.callHook("OnRequestFinished", func() { hooks.OnRequestFinished(req, response) })
+	}
+}
+
+// callHook calls the hook, logging his panic since the response is already sent.
+func (m *HttpDispatcher) callHook(name string, hook func()) {
+	defer func() {
+		if value := recover(); value != nil {
+			m.GetLogger().Printf("panic in the hook %s: %v\n%s", name, value, debug.Stack())
+		}
+	}()
+
+	hook()
+}
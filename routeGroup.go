@@ -0,0 +1,262 @@
+/*
+ * (C) Copyright 2024 Johan Michel PIQUET, France (https://johanpiquet.fr/).
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpServer
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+// HttpRouteGroup allows adding routes under a prefix, with his own middlewares.
+// The handlers of the group see the path without the prefix, the values captured
+// by the prefix being available through the params and the wildcards.
+type HttpRouteGroup struct {
+	host   *HttpHost
+	parent *HttpRouteGroup
+
+	// prefix is the full prefix, including the prefix of the parents.
+	prefix string
+
+	middlewares      []HttpMiddleware
+	middlewaresMutex sync.RWMutex
+}
+
+// Group returns a group whose routes are added under this prefix, for example "/api/v1".
+// The prefix can contain named parameters, like "/tenants/:tenant".
+func (m *HttpHost) Group(prefix string) *HttpRouteGroup {
+	return &HttpRouteGroup{host: m, prefix: normalizeGroupPrefix(prefix)}
+}
+
+// Mount allows the routes of another host to answer under this prefix. The other host is
+// a module which can be mounted many times, for example created with NewHttpHost("", nil, nil).
+func (m *HttpHost) Mount(prefix string, module *HttpHost) {
+	m.Group(prefix).Mount("", module)
+}
+
+// Group returns a sub-group, whose prefix is added to the prefix of this group.
+// The middlewares of this group are called before the middlewares of the sub-group.
+func (m *HttpRouteGroup) Group(prefix string) *HttpRouteGroup {
+	return &HttpRouteGroup{host: m.host, parent: m, prefix: m.prefix + normalizeGroupPrefix(prefix)}
+}
+
+// GetPrefix returns the full prefix of the group.
+func (m *HttpRouteGroup) GetPrefix() string {
+	return m.prefix
+}
+
+// Use adds middlewares called before the handlers of the group and of his sub-groups.
+// They can stop the request by sending a response or calling HttpRequest.StopRequest.
+func (m *HttpRouteGroup) Use(middlewares ...HttpMiddleware) {
+	m.middlewaresMutex.Lock()
+	defer m.middlewaresMutex.Unlock()
+
+	m.middlewares = append(append([]HttpMiddleware(nil), m.middlewares...), middlewares...)
+}
+
+func (m *HttpRouteGroup) VERB(verb string, path string, h HttpMiddleware) {
+	m.addRoute(MethodNameToMethodCode(verb), path, h)
+}
+
+func (m *HttpRouteGroup) GET(path string, h HttpMiddleware) {
+	m.addRoute(HttpMethodGET, path, h)
+}
+
+func (m *HttpRouteGroup) POST(path string, h HttpMiddleware) {
+	m.addRoute(HttpMethodPOST, path, h)
+}
+
+func (m *HttpRouteGroup) HEAD(path string, h HttpMiddleware) {
+	m.addRoute(HttpMethodHEAD, path, h)
+}
+
+func (m *HttpRouteGroup) PUT(path string, h HttpMiddleware) {
+	m.addRoute(HttpMethodPUT, path, h)
+}
+
+func (m *HttpRouteGroup) DELETE(path string, h HttpMiddleware) {
+	m.addRoute(HttpMethodDELETE, path, h)
+}
+
+func (m *HttpRouteGroup) TRACE(path string, h HttpMiddleware) {
+	m.addRoute(HttpMethodTRACE, path, h)
+}
+
+func (m *HttpRouteGroup) OPTIONS(path string, h HttpMiddleware) {
+	m.addRoute(HttpMethodOPTIONS, path, h)
+}
+
+func (m *HttpRouteGroup) CONNECT(path string, h HttpMiddleware) {
+	m.addRoute(HttpMethodCONNECT, path, h)
+}
+
+func (m *HttpRouteGroup) PATCH(path string, h HttpMiddleware) {
+	m.addRoute(HttpMethodPATCH, path, h)
+}
+
+func (m *HttpRouteGroup) AllVerbs(path string, h HttpMiddleware) {
+	for methodCode := HttpMethodGET; methodCode <= HttpMethodPATCH; methodCode++ {
+		m.addRoute(methodCode, path, h)
+	}
+}
+
+// Mount allows the routes of another host to answer under the prefix of the group followed by this prefix.
+// The routes of the module are searched with the path without the prefix,
+// and his middlewares added with HttpHost.Use are called before them.
+func (m *HttpRouteGroup) Mount(prefix string, module *HttpHost) {
+	group := m.Group(prefix)
+
+	h := func(call HttpRequest) error {
+		return group.callModule(call, module)
+	}
+
+	for methodCode := HttpMethodGET; methodCode <= HttpMethodPATCH; methodCode++ {
+		group.addRoute(methodCode, "/", h)
+		group.addRoute(methodCode, "/*", h)
+	}
+}
+
+// NamedRoute adds a route like VERB, with a name allowing to build his url with HttpHost.URLFor.
+// An error is returned if the name is already used by a route with another method or another path.
+func (m *HttpRouteGroup) NamedRoute(name string, verb string, path string, h HttpMiddleware) error {
+	return m.addNamedRoute(MethodNameToMethodCode(verb), name, path, h)
+}
+
+func (m *HttpRouteGroup) addRoute(methodCode HttpMethod, path string, h HttpMiddleware) {
+	m.addNamedRoute(methodCode, "", path, h)
+}
+
+func (m *HttpRouteGroup) addNamedRoute(methodCode HttpMethod, name string, path string, h HttpMiddleware) error {
+	prefixSize := countPathSegments(m.prefix)
+
+	wrapper := func(call HttpRequest) error {
+		fullPath := call.Path()
+		call.SetPath(removePathSegments(fullPath, prefixSize))
+
+		// The response hooks of the host see the full path.
+		defer call.SetPath(fullPath)
+
+		err := m.callMiddlewares(call)
+		if (err != nil) || call.MustStop() || call.IsBodySend() {
+			return err
+		}
+
+		return h(call)
+	}
+
+	if (path == "") || (path == "/") {
+		if m.prefix == "" {
+			path = "/"
+		} else {
+			path = ""
+		}
+	}
+
+	return m.host.addNamedRoute(methodCode, name, m.prefix+path, wrapper)
+}
+
+// callMiddlewares calls the middlewares of the parent groups, then the middlewares of this group.
+func (m *HttpRouteGroup) callMiddlewares(call HttpRequest) error {
+	if m.parent != nil {
+		err := m.parent.callMiddlewares(call)
+		if (err != nil) || call.MustStop() || call.IsBodySend() {
+			return err
+		}
+	}
+
+	m.middlewaresMutex.RLock()
+	middlewares := m.middlewares
+	m.middlewaresMutex.RUnlock()
+
+	return callMiddlewares(call, middlewares)
+}
+
+// callModule searches the route of a mounted host, where the path of the request is already without the prefix.
+// The routing policy of the mounted host is used, while the errors are answered by the host of the request.
+func (m *HttpRouteGroup) callModule(call HttpRequest, module *HttpHost) error {
+	routable, isRoutable := call.(HttpRoutableRequest)
+	if !isRoutable {
+		return errors.New("the request can't be routed to a mounted host")
+	}
+
+	err := callMiddlewares(call, module.GetMiddlewares())
+	if (err != nil) || call.MustStop() || call.IsBodySend() {
+		return err
+	}
+
+	mountUrl := routable.GetResolvedUrl()
+
+	resolvedUrl, isFound := resolveRoute(routable, module)
+	if !isFound {
+		return nil
+	}
+
+	resolvedUrl.addParentCaptures(&mountUrl)
+
+	var hooks *HttpRequestHooks
+
+	if server := call.GetHost().GetServer(); server != nil {
+		hooks = server.GetRequestHooks()
+	}
+
+	return callRoute(routable, resolvedUrl, hooks, m.prefix)
+}
+
+// callMiddlewares calls the middlewares until one of them returns an error or stops the request.
+func callMiddlewares(call HttpRequest, middlewares []HttpMiddleware) error {
+	for _, h := range middlewares {
+		err := h(call)
+
+		if (err != nil) || call.MustStop() || call.IsBodySend() {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// normalizeGroupPrefix returns the prefix beginning with "/" and without "/" at the end.
+func normalizeGroupPrefix(prefix string) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return ""
+	}
+
+	return "/" + prefix
+}
+
+func countPathSegments(prefix string) int {
+	if prefix == "" {
+		return 0
+	}
+
+	return strings.Count(prefix, "/")
+}
+
+// removePathSegments removes the first segments of the path, returning a path beginning with "/".
+func removePathSegments(path string, count int) string {
+	for i := 0; i < count; i++ {
+		index := strings.IndexByte(path[1:], '/')
+		if index == -1 {
+			return "/"
+		}
+
+		path = path[index+1:]
+	}
+
+	return path
+}
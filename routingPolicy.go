@@ -0,0 +1,103 @@
+/*
+ * (C) Copyright 2024 Johan Michel PIQUET, France (https://johanpiquet.fr/).
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpServer
+
+import (
+	"strings"
+)
+
+// TrailingSlashPolicy is what to do when the path only differs from a route by his trailing slash.
+type TrailingSlashPolicy int
+
+const (
+	// TrailingSlashStrict means "/docs" and "/docs/" are two different routes.
+	TrailingSlashStrict TrailingSlashPolicy = iota
+
+	// TrailingSlashRedirect redirects to the path of the route, with a 301 for GET and HEAD, or a 308.
+	TrailingSlashRedirect
+
+	// TrailingSlashMatchBoth allows "/docs" and "/docs/" to match the same route,
+	// and "/docs/" to match "/docs/*".
+	TrailingSlashMatchBoth
+)
+
+// HttpRoutingPolicy changes how the paths of the requests are matched with the routes of a host.
+// It's used by the dispatcher and by the file servers.
+//
+// Whatever the policy, both implementations give the dispatcher a path where the duplicate slashes
+// are collapsed and the "." and ".." are removed. With TrailingSlashRedirect, a request whose path
+// contains duplicate slashes is also redirected to the collapsed path.
+type HttpRoutingPolicy struct {
+	TrailingSlash TrailingSlashPolicy
+
+	// CaseInsensitive allows the static parts of the routes to match without taking care of the case.
+	// The values of the parameters keep their case.
+	CaseInsensitive bool
+}
+
+// SetRoutingPolicy sets how the paths are matched with the routes. Default is strict.
+func (m *HttpHost) SetRoutingPolicy(policy HttpRoutingPolicy) {
+	m.routingPolicy = policy
+}
+
+func (m *HttpHost) GetRoutingPolicy() HttpRoutingPolicy {
+	return m.routingPolicy
+}
+
+func (m *HttpRoutingPolicy) getFindOptions() *UrlResolverFindOptions {
+	return &UrlResolverFindOptions{CaseInsensitive: m.CaseInsensitive}
+}
+
+// RedirectWithTrailingSlash redirects the request to the same url ending by a slash.
+// It's used by the file servers, when a directory is requested without trailing slash.
+func RedirectWithTrailingSlash(req HttpRequest) {
+	routable, isRoutable := req.(HttpRoutableRequest)
+	if !isRoutable {
+		req.Return404UnknownPage()
+		return
+	}
+
+	rawPath, query := splitRequestURI(routable.GetOriginalPathAndQuery())
+	redirectPermanently(req, rawPath+"/"+query)
+}
+
+// splitRequestURI returns the path and the query string, which begins by "?" if not empty.
+func splitRequestURI(requestURI string) (string, string) {
+	index := strings.IndexByte(requestURI, '?')
+	if index == -1 {
+		return requestURI, ""
+	}
+
+	return requestURI[:index], requestURI[index:]
+}
+
+func collapseSlashes(path string) string {
+	for strings.Contains(path, "//") {
+		path = strings.ReplaceAll(path, "//", "/")
+	}
+
+	return path
+}
+
+// toggleTrailingSlash removes the trailing slash of the path, or adds it.
+func toggleTrailingSlash(path string) string {
+	if strings.HasSuffix(path, "/") {
+		return path[:len(path)-1]
+	}
+
+	return path + "/"
+}
@@ -0,0 +1,408 @@
+/*
+ * (C) Copyright 2024 Johan Michel PIQUET, France (https://johanpiquet.fr/).
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpServer
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HttpServerEngine is the part of a server which depends on the library processing the connections.
+type HttpServerEngine interface {
+	// Serve processes the connections of the listener. It returns once the listener is closed,
+	// the error being nil if the engine has been shut down.
+	Serve(listener net.Listener) error
+
+	// Shutdown stops listening and waits until all the connections are idle, or until the context is done.
+	Shutdown(ctx context.Context) error
+
+	// Close closes the connections remaining once the shutdown timeout is reached.
+	Close()
+}
+
+// HttpServerEngineOptions is returned with the engine, telling how to create the listeners.
+type HttpServerEngineOptions struct {
+	// TLSConfig is the configuration of the https listeners. Nil if https isn't enabled.
+	TLSConfig *tls.Config
+
+	// LimitConnections is true if the listeners must apply StartParams.MaxConcurrency
+	// and StartParams.MaxConnsPerIP, for the engines which can't do it.
+	LimitConnections bool
+}
+
+// HttpServerEngineFactory creates the engine when the server starts. The certificates
+// are nil if https isn't enabled. It's called with the lock of the lifecycle.
+type HttpServerEngineFactory func(params *StartParams, certificates *CertificateStore) (HttpServerEngine, HttpServerEngineOptions, error)
+
+// HttpServerLifecycle starts and stops a server, which is the same for all the implementations.
+// It creates the listeners, then gives them to the engine of the implementation.
+type HttpServerLifecycle struct {
+	server       HttpServer
+	dispatcher   *HttpDispatcher
+	createEngine HttpServerEngineFactory
+
+	port        int
+	isStarted   bool
+	startParams StartParams
+
+	engine     HttpServerEngine
+	stateMutex sync.Mutex
+
+	// certificates contains the https certificates, it's nil if https isn't enabled.
+	certificates *CertificateStore
+
+	// done is closed once the server is stopped and
+	// serveError contains the error having stopped it.
+	done       chan struct{}
+	serveError error
+}
+
+func NewHttpServerLifecycle(server HttpServer, port int, dispatcher *HttpDispatcher, createEngine HttpServerEngineFactory) *HttpServerLifecycle {
+	return &HttpServerLifecycle{
+		server:       server,
+		port:         port,
+		dispatcher:   dispatcher,
+		createEngine: createEngine,
+	}
+}
+
+// GetOrCreateHttpServerAt returns the server listening to this address and port,
+// creating it with the function if needed. The address can be an IP or a listen address
+// as returned by StartParams.GetListenAddress.
+func GetOrCreateHttpServerAt(bindAddress string, serverPort int, create func(serverPort int) HttpServer) HttpServer {
+	server := GetHttpServerAt(bindAddress, serverPort)
+
+	if server == nil {
+		server = create(serverPort)
+		params := StartParams{}
+
+		if strings.HasPrefix(bindAddress, "unix:") {
+			params.UnixSocketPath = bindAddress[5:]
+		} else {
+			params.BindAddress = bindAddress
+		}
+
+		server.SetStartServerParams(params)
+		RegisterServer(server)
+	}
+
+	return server
+}
+
+func (m *HttpServerLifecycle) GetPort() int {
+	return m.port
+}
+
+func (m *HttpServerLifecycle) GetBindAddress() string {
+	m.stateMutex.Lock()
+	defer m.stateMutex.Unlock()
+
+	return m.startParams.GetListenAddress()
+}
+
+func (m *HttpServerLifecycle) IsStarted() bool {
+	m.stateMutex.Lock()
+	defer m.stateMutex.Unlock()
+
+	return m.isStarted
+}
+
+func (m *HttpServerLifecycle) Shutdown(timeout time.Duration) bool {
+	// Allows GetOrCreateHttpServerAt to return a new server for this port.
+	UnregisterServer(m.server)
+
+	m.stateMutex.Lock()
+	engine := m.engine
+	m.engine = nil
+	m.isStarted = false
+	m.stateMutex.Unlock()
+
+	if engine == nil {
+		return true
+	}
+
+	if timeout <= 0 {
+		timeout = gDefaultShutdownTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// Stop listening and wait until all the connections are idle.
+	err := engine.Shutdown(ctx)
+	if err == nil {
+		return true
+	}
+
+	// The timeout is reached, we force closing what remains.
+	engine.Close()
+	return false
+}
+
+// StartServer starts the server and blocks until the server is stopped.
+func (m *HttpServerLifecycle) StartServer() error {
+	err := m.Start()
+	if err != nil {
+		return err
+	}
+
+	return m.Wait()
+}
+
+// Start starts the server without blocking. It returns once the socket
+// is listening, or returns the error if the socket can't be bound.
+func (m *HttpServerLifecycle) Start() error {
+	m.stateMutex.Lock()
+	defer m.stateMutex.Unlock()
+
+	if m.isStarted {
+		return nil
+	}
+
+	certificates, err := m.dispatcher.Configure(&m.startParams)
+	if err != nil {
+		return err
+	}
+
+	engine, options, err := m.createEngine(&m.startParams, certificates)
+	if err != nil {
+		return err
+	}
+
+	listeners, err := m.listenAll(options)
+	if err != nil {
+		return err
+	}
+
+	m.certificates = certificates
+
+	if certificates != nil {
+		interval := time.Second * time.Duration(m.startParams.CertificatesCheckIntervalInSec)
+		if interval <= 0 {
+			interval = gDefaultCertificatesCheckInterval
+		}
+
+		certificates.StartWatching(interval)
+	}
+
+	done := make(chan struct{})
+
+	m.engine = engine
+	m.done = done
+	m.serveError = nil
+	m.isStarted = true
+
+	var wg sync.WaitGroup
+
+	for _, listener := range listeners {
+		wg.Add(1)
+
+		go func(listener net.Listener) {
+			defer wg.Done()
+
+			// Returns nil once the server is shut down.
+			err := engine.Serve(listener)
+
+			if err != nil {
+				m.stateMutex.Lock()
+				if m.serveError == nil {
+					m.serveError = err
+				}
+				m.stateMutex.Unlock()
+
+				// The server can't work partially, then stop the other listeners.
+				for _, other := range listeners {
+					_ = other.Close()
+				}
+			}
+		}(listener)
+	}
+
+	go func() {
+		wg.Wait()
+
+		m.stateMutex.Lock()
+		if m.engine == engine {
+			m.engine = nil
+			m.isStarted = false
+		}
+
+		if certificates != nil {
+			certificates.StopWatching()
+		}
+		m.stateMutex.Unlock()
+
+		close(done)
+	}()
+
+	return nil
+}
+
+// listenAll creates the listeners. When StartParams.HttpsPort is set, there is
+// a plain http listener on the server port and a https listener on the https port.
+// Otherwise, there is only one listener which is https if https is enabled.
+func (m *HttpServerLifecycle) listenAll(options HttpServerEngineOptions) ([]net.Listener, error) {
+	params := &m.startParams
+
+	limit := func(listener net.Listener) net.Listener {
+		if options.LimitConnections {
+			return newLimitedListener(listener, params.MaxConcurrency, params.MaxConnsPerIP)
+		}
+
+		return listener
+	}
+
+	listener, err := m.listen()
+	if err != nil {
+		return nil, err
+	}
+
+	listener = limit(listener)
+
+	if options.TLSConfig == nil {
+		return []net.Listener{listener}, nil
+	}
+
+	if params.HttpsPort == 0 {
+		return []net.Listener{tls.NewListener(listener, options.TLSConfig.Clone())}, nil
+	}
+
+	httpsListener, err := net.Listen("tcp", net.JoinHostPort(params.BindAddress, strconv.Itoa(params.HttpsPort)))
+	if err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+
+	httpsListener = limit(httpsListener)
+
+	return []net.Listener{listener, tls.NewListener(httpsListener, options.TLSConfig.Clone())}, nil
+}
+
+// listen creates the listener, which is a TCP socket,
+// a unix socket or the listener given by the caller.
+func (m *HttpServerLifecycle) listen() (net.Listener, error) {
+	params := &m.startParams
+
+	if params.Listener != nil {
+		return params.Listener, nil
+	}
+
+	if params.UnixSocketPath != "" {
+		// Remove the socket file remaining from a previous run, but never another kind of file.
+		stat, err := os.Lstat(params.UnixSocketPath)
+
+		if err == nil {
+			if stat.Mode()&os.ModeSocket == 0 {
+				return nil, fmt.Errorf("can't listen to %s: the file exists and isn't a socket", params.UnixSocketPath)
+			}
+
+			err = os.Remove(params.UnixSocketPath)
+		}
+
+		if (err != nil) && !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		listener, err := net.Listen("unix", params.UnixSocketPath)
+		if err != nil {
+			return nil, err
+		}
+
+		fileMode := params.UnixSocketFileMode
+		if fileMode == 0 {
+			fileMode = 0660
+		}
+
+		err = os.Chmod(params.UnixSocketPath, fileMode)
+		if err != nil {
+			_ = listener.Close()
+			return nil, err
+		}
+
+		return listener, nil
+	}
+
+	return net.Listen("tcp", net.JoinHostPort(params.BindAddress, strconv.Itoa(m.port)))
+}
+
+// Wait blocks until the server is stopped and returns the error
+// having stopped it, which is nil if stopped by Shutdown.
+// Returns immediately if the server isn't started.
+func (m *HttpServerLifecycle) Wait() error {
+	done := m.Done()
+	<-done
+
+	m.stateMutex.Lock()
+	defer m.stateMutex.Unlock()
+
+	return m.serveError
+}
+
+// Done returns a channel which is closed once the server is stopped.
+func (m *HttpServerLifecycle) Done() <-chan struct{} {
+	m.stateMutex.Lock()
+	defer m.stateMutex.Unlock()
+
+	if m.done == nil {
+		return gClosedChannel
+	}
+
+	return m.done
+}
+
+func (m *HttpServerLifecycle) GetCertificateStore() *CertificateStore {
+	m.stateMutex.Lock()
+	defer m.stateMutex.Unlock()
+
+	return m.certificates
+}
+
+func (m *HttpServerLifecycle) SetStartServerParams(params StartParams) {
+	// The listen address is part of the registration key.
+	// Registering calls GetBindAddress, which is why it's done without the lock.
+	isRegistered := UnregisterServer(m.server)
+
+	m.stateMutex.Lock()
+	m.startParams = params
+	m.stateMutex.Unlock()
+
+	if isRegistered {
+		RegisterServer(m.server)
+	}
+}
+
+// gClosedChannel is returned by Done when the server has never been started.
+var gClosedChannel = func() chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}()
+
+// gDefaultCertificatesCheckInterval is the interval between two
+// checks of the certificate files, in order to reload them once renewed.
+const gDefaultCertificatesCheckInterval = time.Minute
+
+// gDefaultShutdownTimeout is the time let to the requests in progress
+// to finish when the server is shut down.
+const gDefaultShutdownTimeout = time.Second * 10
@@ -47,6 +47,32 @@ func MethodNameToMethodCode(method string) HttpMethod {
 	}
 }
 
+// MethodCodeToMethodName returns the name of the method, like "GET".
+func MethodCodeToMethodName(methodCode HttpMethod) string {
+	switch methodCode {
+	case HttpMethodGET:
+		return "GET"
+	case HttpMethodPOST:
+		return "POST"
+	case HttpMethodHEAD:
+		return "HEAD"
+	case HttpMethodDELETE:
+		return "DELETE"
+	case HttpMethodPUT:
+		return "PUT"
+	case HttpMethodCONNECT:
+		return "CONNECT"
+	case HttpMethodOPTIONS:
+		return "OPTIONS"
+	case HttpMethodTRACE:
+		return "TRACE"
+	case HttpMethodPATCH:
+		return "PATCH"
+	default:
+		return ""
+	}
+}
+
 func SaveStreamBodyToFile(reader io.Reader, outFilePath string) error {
 	fo, err := os.Create(outFilePath)
 	if err != nil {
@@ -17,22 +17,49 @@
 package httpServer
 
 import (
+	"fmt"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 // UrlResolver allows to bind an listener to an url part. It's a router.
+//
+// Find never locks: it reads an immutable snapshot of the routes. A change copies the nodes
+// from the root to the modified node, the other nodes being shared with the previous snapshot,
+// then replaces the snapshot at once. It allows adding routes while the requests are processed.
 type UrlResolver struct {
-	root urlResolverPathPart
+	snapshot atomic.Pointer[urlResolverSnapshot]
+
+	// mutex avoids two changes done at the same time, where one would be lost.
+	mutex sync.Mutex
+}
+
+// urlResolverSnapshot is never modified once stored in UrlResolver.snapshot,
+// like the nodes of his tree.
+type urlResolverSnapshot struct {
+	root *urlResolverPathPart
+
+	// names contains the patterns of the named routes, allowing to build their url.
+	names map[string]string
 }
 
+var gEmptyUrlResolverSnapshot = &urlResolverSnapshot{root: &urlResolverPathPart{}}
+
 type UrlResolverResult struct {
 	Target      any
 	Middlewares []any
 
+	pattern      string
+	tag          any
 	wildcards    []string
 	rawWildcards []string
+
+	// rawParams are the named parameters, in reverse order like rawWildcards.
+	rawParams []UrlResolverParam
+	params    []UrlResolverParam
 }
 
 type UrlResolverTreeItem struct {
@@ -47,12 +74,16 @@ type urlResolverPathWildCard struct {
 }
 
 type urlResolverPathPart struct {
-	parent *urlResolverPathPart
+	segmentMap map[string]*urlResolverPathPart
+	beginByMap map[string]*urlResolverPathPart
 
-	segmentMap        map[string]*urlResolverPathPart
-	beginByMap        map[string]*urlResolverPathPart
+	// beginByMapOrdered contains the entries of beginByMap, from the taller prefix to the shorter.
+	// It's rebuilt each time beginByMap changes.
 	beginByMapOrdered []urlResolverPathWildCard
 
+	// paramSegments are the segments with named parameters, those with a constraint being first.
+	paramSegments []*urlResolverParamSegment
+
 	pathPrefix string
 
 	exactHandler    any
@@ -79,6 +110,111 @@ func NewUrlResolver() *UrlResolver {
 	return &UrlResolver{}
 }
 
+// load returns the current snapshot, which must not be modified.
+func (m *UrlResolver) load() *urlResolverSnapshot {
+	snapshot := m.snapshot.Load()
+	if snapshot == nil {
+		return gEmptyUrlResolverSnapshot
+	}
+
+	return snapshot
+}
+
+// edit calls f with a copy of the node designed by the segments, then replaces the snapshot
+// if f returns true. The missing nodes are created if create is true, otherwise
+// nothing is done when the node doesn't exist. Only one change is done at once.
+func (m *UrlResolver) edit(segments []string, create bool, f func(snapshot *urlResolverSnapshot, node *urlResolverPathPart) bool) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	current := m.load()
+	next := &urlResolverSnapshot{names: current.names}
+
+	next.root = current.root.edit(segments, "", nil, create, func(node *urlResolverPathPart) bool {
+		return f(next, node)
+	})
+
+	if next.root == nil {
+		return false
+	}
+
+	m.snapshot.Store(next)
+	return true
+}
+
+// setNames replaces the names of the snapshot by a copy modified by the function.
+func (m *urlResolverSnapshot) setNames(update func(names map[string]string)) {
+	names := make(map[string]string, len(m.names)+1)
+
+	for name, pattern := range m.names {
+		names[name] = pattern
+	}
+
+	update(names)
+	m.names = names
+}
+
+// GetPattern returns the path of the route matching the url, for example "/user/*".
+func (m *UrlResolverResult) GetPattern() string {
+	return m.pattern
+}
+
+// GetTag returns the tag given when adding the route.
+func (m *UrlResolverResult) GetTag() any {
+	return m.tag
+}
+
+// GetParams returns the values of the named parameters, in the order of the route.
+func (m *UrlResolverResult) GetParams() []UrlResolverParam {
+	if m.rawParams == nil {
+		return nil
+	}
+
+	if m.params == nil {
+		size := len(m.rawParams)
+		m.params = make([]UrlResolverParam, size)
+
+		for i, param := range m.rawParams {
+			m.params[size-1-i] = param
+		}
+	}
+
+	return m.params
+}
+
+// GetParam returns the value of the named parameter, or an empty string.
+func (m *UrlResolverResult) GetParam(name string) string {
+	for _, param := range m.rawParams {
+		if param.Name == name {
+			return param.Value
+		}
+	}
+
+	return ""
+}
+
+// addParentCaptures adds the params and the wildcards captured by the route of a mounted host
+// before the values captured by this result. The wildcard matching the path of the mounted host,
+// which is the last one of a route ending by "/*", isn't added.
+func (m *UrlResolverResult) addParentCaptures(parent *UrlResolverResult) {
+	parentWildcards := parent.rawWildcards
+
+	if strings.HasSuffix(parent.pattern, "/*") && (len(parentWildcards) != 0) {
+		// The raw values are in reverse order.
+		parentWildcards = parentWildcards[1:]
+	}
+
+	if len(parent.rawParams) != 0 {
+		m.rawParams = append(append([]UrlResolverParam(nil), m.rawParams...), parent.rawParams...)
+		m.params = nil
+	}
+
+	if len(parentWildcards) != 0 {
+		m.rawWildcards = append(append([]string(nil), m.rawWildcards...), parentWildcards...)
+		m.wildcards = nil
+	}
+}
+
 func (m *UrlResolverResult) GetWildcards() []string {
 	if m.rawWildcards == nil {
 		return nil
@@ -102,10 +238,24 @@ func (m *UrlResolverResult) GetWildcards() []string {
 }
 
 func (m *UrlResolver) Print() {
-	m.root.print("")
+	m.load().root.print("")
+}
+
+// UrlResolverFindOptions allows changing how FindWithOptions matches the urls.
+type UrlResolverFindOptions struct {
+	// CaseInsensitive allows the static parts of the routes to match without taking care of the case.
+	CaseInsensitive bool
+
+	// MatchEmptyCatchAll allows "/docs/" to match "/docs/*".
+	MatchEmptyCatchAll bool
 }
 
 func (m *UrlResolver) Find(path string) UrlResolverResult {
+	return m.FindWithOptions(path, nil)
+}
+
+// FindWithOptions is like Find, with options changing how the urls are matched. Options can be nil.
+func (m *UrlResolver) FindWithOptions(path string, options *UrlResolverFindOptions) UrlResolverResult {
 	result := UrlResolverResult{}
 
 	var parts []string
@@ -116,24 +266,62 @@ func (m *UrlResolver) Find(path string) UrlResolverResult {
 		parts = (strings.Split(path, "/"))[1:]
 	}
 
-	m.root.find(parts, &result)
+	if options == nil {
+		options = &gDefaultFindOptions
+	}
+
+	m.load().root.find(parts, &result, options)
 
 	return result
 }
 
+var gDefaultFindOptions UrlResolverFindOptions
+
 func (m *UrlResolver) Add(path string, handler any, tag any) {
-	if len(path) != 0 {
-		if path[0] == '/' {
-			path = path[1:]
+	_ = m.AddNamed("", path, handler, tag)
+}
+
+// AddNamed adds a route like Add, with a name allowing to get his pattern with GetNamedPattern.
+// Without name, it's the same as Add. An error is returned, and nothing is added,
+// if the name is already used by another route.
+func (m *UrlResolver) AddNamed(name string, path string, handler any, tag any) error {
+	segments := splitResolverPath(path)
+	isCatchAll := isCatchAllPath(segments)
+
+	var err error
+
+	m.edit(segments, true, func(snapshot *urlResolverSnapshot, node *urlResolverPathPart) bool {
+		if name != "" {
+			if pattern, found := snapshot.names[name]; found && (pattern != node.getPattern(isCatchAll)) {
+				err = fmt.Errorf("the route name %q is already used by %q", name, pattern)
+				return false
+			}
 		}
-	}
 
-	parts := strings.Split(path, "/")
-	if path == "" {
-		parts = parts[0:0]
-	}
+		if isCatchAll {
+			node.catchAllHandler = handler
+			node.catchAllHandlerTag = tag
+		} else {
+			node.exactHandler = handler
+			node.exactHandlerTag = tag
+		}
+
+		if name != "" {
+			snapshot.setNames(func(names map[string]string) {
+				names[name] = node.getPattern(isCatchAll)
+			})
+		}
 
-	m.root.addPath(parts, "", handler, tag)
+		return true
+	})
+
+	return err
+}
+
+// GetNamedPattern returns the pattern of the route added with this name, like "/users/:id".
+func (m *UrlResolver) GetNamedPattern(name string) (string, bool) {
+	pattern, found := m.load().names[name]
+	return pattern, found
 }
 
 // AppendMiddleware add a handler which is always executed before the other handlers.
@@ -150,16 +338,114 @@ func (m *UrlResolver) AppendMiddleware(path string, handler any, tag any) {
 		path = path[0 : len(path)-2]
 	}
 
-	parts := strings.Split(path, "/")
+	segments := splitResolverPath(path)
+
+	// Here the ends /* is removed before, so it only happens with "/*".
+	if isCatchAllPath(segments) {
+		return
+	}
+
+	m.edit(segments, true, func(snapshot *urlResolverSnapshot, node *urlResolverPathPart) bool {
+		node.exactHandlerTag = tag
+
+		if isExactMatch {
+			node.exactMiddlewares = append(node.exactMiddlewares[:len(node.exactMiddlewares):len(node.exactMiddlewares)], handler)
+		} else {
+			node.childMiddlewares = append(node.childMiddlewares[:len(node.childMiddlewares):len(node.childMiddlewares)], handler)
+		}
+
+		return true
+	})
+}
+
+// Remove removes the handler added for this path, returning false if there is none.
+// The middlewares of the path are kept.
+func (m *UrlResolver) Remove(path string) bool {
+	segments := splitResolverPath(path)
+	isCatchAll := isCatchAllPath(segments)
+
+	return m.edit(segments, false, func(snapshot *urlResolverSnapshot, node *urlResolverPathPart) bool {
+		if isCatchAll {
+			if node.catchAllHandler == nil {
+				return false
+			}
+
+			node.catchAllHandler = nil
+			node.catchAllHandlerTag = nil
+		} else {
+			if node.exactHandler == nil {
+				return false
+			}
+
+			node.exactHandler = nil
+			node.exactHandlerTag = nil
+		}
+
+		pattern := node.getPattern(isCatchAll)
+
+		snapshot.setNames(func(names map[string]string) {
+			for name, namedPattern := range names {
+				if namedPattern == pattern {
+					delete(names, name)
+				}
+			}
+		})
+
+		return true
+	})
+}
+
+// RemoveMiddlewares removes the middlewares added with AppendMiddleware for this path,
+// returning false if there is none. Like with AppendMiddleware, a path ending by "/*"
+// designs the middlewares applied to the children.
+func (m *UrlResolver) RemoveMiddlewares(path string) bool {
+	isExactMatch := !strings.HasSuffix(path, "/*")
+
+	if !isExactMatch {
+		path = path[0 : len(path)-2]
+	}
+
+	return m.edit(splitResolverPath(path), false, func(snapshot *urlResolverSnapshot, node *urlResolverPathPart) bool {
+		if isExactMatch {
+			if node.exactMiddlewares == nil {
+				return false
+			}
+
+			node.exactMiddlewares = nil
+		} else {
+			if node.childMiddlewares == nil {
+				return false
+			}
+
+			node.childMiddlewares = nil
+		}
+
+		return true
+	})
+}
+
+// splitResolverPath returns the segments of the path, like Add does.
+func splitResolverPath(path string) []string {
+	if len(path) != 0 {
+		if path[0] == '/' {
+			path = path[1:]
+		}
+	}
+
 	if path == "" {
-		parts = parts[0:0]
+		return []string{}
 	}
 
-	m.root.appendMiddleware(parts, "", handler, tag, isExactMatch)
+	return strings.Split(path, "/")
+}
+
+// isCatchAllPath returns true if the last segment is "*", which designs the catch-all of a node.
+func isCatchAllPath(segments []string) bool {
+	return (len(segments) != 0) && (segments[len(segments)-1] == "*")
 }
 
 func (m *UrlResolver) DumpTree() []UrlResolverTreeItem {
-	return m.root.dumpTree(nil)
+	return m.load().root.dumpTree(nil)
 }
 
 func (m *urlResolverPathPart) dumpTree(tree []UrlResolverTreeItem) []UrlResolverTreeItem {
@@ -204,6 +490,10 @@ func (m *urlResolverPathPart) dumpTree(tree []UrlResolverTreeItem) []UrlResolver
 		}
 	}
 
+	for _, entry := range m.paramSegments {
+		tree = entry.next.dumpTree(tree)
+	}
+
 	if m.segmentMap != nil {
 		for _, entry := range m.segmentMap {
 			tree = entry.dumpTree(tree)
@@ -213,22 +503,6 @@ func (m *urlResolverPathPart) dumpTree(tree []UrlResolverTreeItem) []UrlResolver
 	return tree
 }
 
-func (m *urlResolverPathPart) walk(handler func(*urlResolverPathPart)) {
-	handler(m)
-
-	if m.beginByMap != nil {
-		for _, entry := range m.beginByMap {
-			entry.walk(handler)
-		}
-	}
-
-	if m.segmentMap != nil {
-		for _, entry := range m.segmentMap {
-			entry.walk(handler)
-		}
-	}
-}
-
 func (m *urlResolverPathPart) print(tab string) {
 	info := ""
 
@@ -254,6 +528,10 @@ func (m *urlResolverPathPart) print(tab string) {
 		}
 	}
 
+	for _, entry := range m.paramSegments {
+		info += "[param:" + entry.pattern + "]"
+	}
+
 	if info == "" {
 		info = "[empty]"
 	}
@@ -271,6 +549,10 @@ func (m *urlResolverPathPart) print(tab string) {
 		}
 	}
 
+	for _, entry := range m.paramSegments {
+		entry.next.print(tab + "   ")
+	}
+
 	if m.segmentMap != nil {
 		for _, value := range m.segmentMap {
 			value.print(tab + "   ")
@@ -278,7 +560,7 @@ func (m *urlResolverPathPart) print(tab string) {
 	}
 }
 
-func (m *urlResolverPathPart) find(segments []string, result *UrlResolverResult) bool {
+func (m *urlResolverPathPart) find(segments []string, result *UrlResolverResult, options *UrlResolverFindOptions) bool {
 	// Exact same length ?
 	//
 	if len(segments) == 0 {
@@ -287,6 +569,8 @@ func (m *urlResolverPathPart) find(segments []string, result *UrlResolverResult)
 		}
 
 		result.Target = m.exactHandler
+		result.tag = m.exactHandlerTag
+		result.pattern = m.getPattern(false)
 
 		if m.exactMiddlewares != nil {
 			result.Middlewares = m.exactMiddlewaresCache
@@ -302,8 +586,17 @@ func (m *urlResolverPathPart) find(segments []string, result *UrlResolverResult)
 	if m.segmentMap != nil {
 		entry := m.segmentMap[s0]
 
+		if (entry == nil) && options.CaseInsensitive {
+			for key, value := range m.segmentMap {
+				if strings.EqualFold(key, s0) {
+					entry = value
+					break
+				}
+			}
+		}
+
 		if entry != nil {
-			if entry.find(segments[1:], result) {
+			if entry.find(segments[1:], result, options) {
 				return true
 			}
 		}
@@ -311,42 +604,42 @@ func (m *urlResolverPathPart) find(segments []string, result *UrlResolverResult)
 
 	// Starts with a prefix?
 	//
-	if m.beginByMap != nil {
-		// This part is only done once.
-		//
-		if m.beginByMapOrdered == nil {
-			var entries []urlResolverPathWildCard
-
-			for key, entry := range m.beginByMap {
-				entries = append(entries, urlResolverPathWildCard{prefix: key, next: entry})
+	for _, entry := range m.beginByMapOrdered {
+		if hasSegmentPrefix(s0, entry.prefix, options.CaseInsensitive) && (len(entry.prefix) != len(s0)) {
+			if entry.next.find(segments[1:], result, options) {
+				result.rawWildcards = append(result.rawWildcards, s0[len(entry.prefix):])
+				return true
 			}
 
-			// Sort from taller to shorter.
-			//
-			sort.Slice(entries, func(i, j int) bool {
-				return entries[i].prefix > entries[j].prefix
-			})
-
-			m.beginByMapOrdered = entries
+			break
 		}
+	}
 
-		for _, entry := range m.beginByMapOrdered {
-			if strings.HasPrefix(s0, entry.prefix) && (entry.prefix != s0) {
-				if entry.next.find(segments[1:], result) {
-					result.rawWildcards = append(result.rawWildcards, s0[len(entry.prefix):])
-					return true
-				}
+	// Match a segment with named parameters?
+	//
+	for _, entry := range m.paramSegments {
+		values := entry.match(s0)
+		if values == nil {
+			continue
+		}
 
-				break
+		if entry.next.find(segments[1:], result, options) {
+			// Added in reverse order, like the wildcards.
+			for i := len(values) - 1; i >= 0; i-- {
+				result.rawParams = append(result.rawParams, UrlResolverParam{Name: entry.names[i], Value: values[i]})
 			}
+
+			return true
 		}
 	}
 
 	// There is a catch-all?
 	//
 	if m.catchAllHandler != nil {
-		if (s0 != "") && (s0 != "/") {
+		if ((s0 != "") && (s0 != "/")) || (options.MatchEmptyCatchAll && (s0 == "") && (len(segments) == 1)) {
 			result.Target = m.catchAllHandler
+			result.tag = m.catchAllHandlerTag
+			result.pattern = m.getPattern(true)
 
 			if m.childMiddlewares != nil {
 				result.Middlewares = m.catchAllMiddlewaresCache
@@ -359,144 +652,191 @@ func (m *urlResolverPathPart) find(segments []string, result *UrlResolverResult)
 	return false
 }
 
-func (m *urlResolverPathPart) addPath(segments []string, pathPrefix string, handler any, tag any) {
-	m.pathPrefix = pathPrefix
+// edit returns a copy of this node, where the node designed by the segments is a copy given to f.
+// Only the nodes from this node to the designed node are copied, the others are shared with the
+// previous snapshot. The nodes becoming empty are removed. It returns nil if f returns false,
+// or if the node doesn't exist and create is false.
+func (m *urlResolverPathPart) edit(segments []string, pathPrefix string, parentMiddlewares []any, create bool, f func(node *urlResolverPathPart) bool) *urlResolverPathPart {
+	res := *m
+	res.pathPrefix = pathPrefix
+
+	// A path ending by "/*" designs the catch-all of this node.
+	if (len(segments) == 0) || ((len(segments) == 1) && (segments[0] == "*")) {
+		if !f(&res) {
+			return nil
+		}
 
-	if len(segments) == 0 {
-		m.exactHandler = handler
-		m.exactHandlerTag = tag
-		m.updateMiddlewaresForMe()
-		return
+		// The middlewares of the children depend on those of this node.
+		if len(res.childMiddlewares) != len(m.childMiddlewares) {
+			return res.withParentMiddlewares(parentMiddlewares)
+		}
+
+		res.updateMiddlewaresCache(parentMiddlewares)
+		return &res
 	}
 
+	res.updateMiddlewaresCache(parentMiddlewares)
+
 	s0 := segments[0]
+	pathPrefix += "/" + s0
 
-	if strings.HasSuffix(s0, "*") {
-		// Ends by "/*" then will catch all the urls.
-		//
-		if (s0 == "*") && (len(segments) == 1) {
-			m.catchAllHandler = handler
-			m.catchAllHandlerTag = tag
-			m.updateMiddlewaresForMe()
-			return
+	editNext := func(next *urlResolverPathPart) *urlResolverPathPart {
+		return next.edit(segments[1:], pathPrefix, res.catchAllMiddlewaresCache, create, f)
+	}
+
+	if isParamSegment(s0) {
+		if !res.editParamSegment(s0, create, editNext) {
+			return nil
 		}
 
-		if m.beginByMap == nil {
-			m.beginByMap = make(map[string]*urlResolverPathPart)
+		return &res
+	}
+
+	if strings.HasSuffix(s0, "*") {
+		beginByMap, isEdited := editChild(res.beginByMap, s0[0:len(s0)-1], create, editNext)
+		if !isEdited {
+			return nil
 		}
 
-		m.beginByMapOrdered = nil
+		res.beginByMap = beginByMap
+		res.orderBeginBy()
+
+		return &res
+	}
 
-		pathPrefix += "/" + s0
-		s0 = s0[0 : len(s0)-1]
-		current := m.beginByMap[s0]
+	segmentMap, isEdited := editChild(res.segmentMap, s0, create, editNext)
+	if !isEdited {
+		return nil
+	}
+
+	res.segmentMap = segmentMap
+	return &res
+}
 
-		if current == nil {
-			current = &urlResolverPathPart{parent: m}
-			m.beginByMap[s0] = current
+// editChild returns a copy of the map, where the child having this key is replaced by the result of edit,
+// or removed if this result is empty. It returns false if the edition failed.
+func editChild(children map[string]*urlResolverPathPart, key string, create bool, edit func(next *urlResolverPathPart) *urlResolverPathPart) (map[string]*urlResolverPathPart, bool) {
+	next := children[key]
+
+	if next == nil {
+		if !create {
+			return nil, false
 		}
 
-		current.addPath(segments[1:], pathPrefix, handler, tag)
-		return
+		next = &urlResolverPathPart{}
 	}
 
-	pathPrefix += "/" + s0
+	next = edit(next)
+	if next == nil {
+		return nil, false
+	}
 
-	if m.segmentMap == nil {
-		m.segmentMap = make(map[string]*urlResolverPathPart)
-	} else {
-		next := m.segmentMap[s0]
+	res := make(map[string]*urlResolverPathPart, len(children)+1)
 
-		if next != nil {
-			next.addPath(segments[1:], pathPrefix, handler, tag)
-			return
-		}
+	for k, entry := range children {
+		res[k] = entry
 	}
 
-	pp := &urlResolverPathPart{parent: m}
-	m.segmentMap[s0] = pp
-	pp.addPath(segments[1:], pathPrefix, handler, tag)
-}
+	if next.isEmpty() {
+		delete(res, key)
+	} else {
+		res[key] = next
+	}
 
-func (m *urlResolverPathPart) appendMiddleware(segments []string, pathPrefix string, handler any, tag any, exactMatch bool) {
-	m.pathPrefix = pathPrefix
+	return res, true
+}
 
-	if len(segments) == 0 {
-		m.exactHandlerTag = tag
+// editParamSegment is like editChild, for the child of this segment with named parameters.
+// The slice of the segments is replaced by a copy.
+func (m *urlResolverPathPart) editParamSegment(pattern string, create bool, edit func(next *urlResolverPathPart) *urlResolverPathPart) bool {
+	index := -1
 
-		if exactMatch {
-			m.exactMiddlewares = append(m.exactMiddlewares, handler)
-			m.updateMiddlewaresForMe()
-		} else {
-			m.childMiddlewares = append(m.childMiddlewares, handler)
-			m.updateMiddlewaresForChildren()
+	for i, entry := range m.paramSegments {
+		if entry.pattern == pattern {
+			index = i
+			break
 		}
+	}
 
-		return
+	var entry urlResolverParamSegment
+
+	if index != -1 {
+		entry = *m.paramSegments[index]
+	} else if create {
+		entry = *newUrlResolverParamSegment(pattern)
+		entry.next = &urlResolverPathPart{}
+	} else {
+		return false
 	}
 
-	s0 := segments[0]
+	entry.next = edit(entry.next)
+	if entry.next == nil {
+		return false
+	}
 
-	if strings.HasSuffix(s0, "*") {
-		if (s0 == "*") && (len(segments) == 1) {
-			// Here the ends /* is removed before calling,
-			// so this case must never append.
-			//
-			return
-		}
+	paramSegments := append([]*urlResolverParamSegment(nil), m.paramSegments...)
 
-		if m.beginByMap == nil {
-			m.beginByMap = make(map[string]*urlResolverPathPart)
+	if index != -1 {
+		if entry.next.isEmpty() {
+			paramSegments = append(paramSegments[:index], paramSegments[index+1:]...)
+		} else {
+			paramSegments[index] = &entry
 		}
 
-		m.beginByMapOrdered = nil
+		m.paramSegments = paramSegments
+		return true
+	}
 
-		pathPrefix += "/" + s0
-		s0 = s0[0 : len(s0)-1]
-		current := m.beginByMap[s0]
+	// The segments with a constraint are tested first, since they are more specific.
+	index = len(paramSegments)
 
-		if current == nil {
-			current = &urlResolverPathPart{parent: m}
-			m.beginByMap[s0] = current
+	if entry.matcher != nil {
+		for i, current := range paramSegments {
+			if current.matcher == nil {
+				index = i
+				break
+			}
 		}
-
-		current.appendMiddleware(segments[1:], pathPrefix, handler, tag, exactMatch)
-		return
 	}
 
-	pathPrefix += "/" + s0
+	m.paramSegments = append(paramSegments[:index:index], append([]*urlResolverParamSegment{&entry}, paramSegments[index:]...)...)
+	return true
+}
 
-	if m.segmentMap == nil {
-		m.segmentMap = make(map[string]*urlResolverPathPart)
-	} else {
-		next := m.segmentMap[s0]
+// orderBeginBy builds beginByMapOrdered from beginByMap.
+func (m *urlResolverPathPart) orderBeginBy() {
+	var entries []urlResolverPathWildCard
 
-		if next != nil {
-			next.appendMiddleware(segments[1:], pathPrefix, handler, tag, exactMatch)
-			return
-		}
+	for key, entry := range m.beginByMap {
+		entries = append(entries, urlResolverPathWildCard{prefix: key, next: entry})
 	}
 
-	pp := &urlResolverPathPart{parent: m}
-	m.segmentMap[s0] = pp
-	pp.appendMiddleware(segments[1:], pathPrefix, handler, tag, exactMatch)
+	// Sort from taller to shorter.
+	//
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].prefix > entries[j].prefix
+	})
+
+	m.beginByMapOrdered = entries
 }
 
-func (m *urlResolverPathPart) updateMiddlewaresForMe() {
-	p := m.parent
-	var parentMiddlewares []any
+func hasSegmentPrefix(segment string, prefix string, caseInsensitive bool) bool {
+	if caseInsensitive {
+		return (len(segment) >= len(prefix)) && strings.EqualFold(segment[:len(prefix)], prefix)
+	}
 
-	for {
-		if p == nil {
-			break
-		}
+	return strings.HasPrefix(segment, prefix)
+}
 
-		if p.childMiddlewares != nil {
-			parentMiddlewares = append(p.childMiddlewares, parentMiddlewares...)
-		}
+func (m *urlResolverPathPart) isEmpty() bool {
+	return (m.exactHandler == nil) && (m.catchAllHandler == nil) &&
+		(m.exactMiddlewares == nil) && (m.childMiddlewares == nil) &&
+		(len(m.segmentMap) == 0) && (len(m.beginByMap) == 0) && (len(m.paramSegments) == 0)
+}
 
-		p = p.parent
-	}
+// updateMiddlewaresCache merges the middlewares of this node with the childMiddlewares of his parents.
+func (m *urlResolverPathPart) updateMiddlewaresCache(parentMiddlewares []any) {
+	parentMiddlewares = parentMiddlewares[:len(parentMiddlewares):len(parentMiddlewares)]
 
 	if m.exactMiddlewares == nil {
 		m.exactMiddlewaresCache = parentMiddlewares
@@ -511,8 +851,50 @@ func (m *urlResolverPathPart) updateMiddlewaresForMe() {
 	}
 }
 
-func (m *urlResolverPathPart) updateMiddlewaresForChildren() {
-	m.walk(func(c *urlResolverPathPart) {
-		c.updateMiddlewaresForMe()
-	})
+// withParentMiddlewares returns a copy of this node and of his children,
+// where the middlewares caches are rebuilt with these middlewares of the parents.
+func (m *urlResolverPathPart) withParentMiddlewares(parentMiddlewares []any) *urlResolverPathPart {
+	res := *m
+	res.updateMiddlewaresCache(parentMiddlewares)
+
+	copyChildren := func(children map[string]*urlResolverPathPart) map[string]*urlResolverPathPart {
+		if children == nil {
+			return nil
+		}
+
+		copied := make(map[string]*urlResolverPathPart, len(children))
+
+		for key, entry := range children {
+			copied[key] = entry.withParentMiddlewares(res.catchAllMiddlewaresCache)
+		}
+
+		return copied
+	}
+
+	res.segmentMap = copyChildren(m.segmentMap)
+	res.beginByMap = copyChildren(m.beginByMap)
+	res.orderBeginBy()
+
+	res.paramSegments = nil
+
+	for _, entry := range m.paramSegments {
+		paramSegment := *entry
+		paramSegment.next = entry.next.withParentMiddlewares(res.catchAllMiddlewaresCache)
+		res.paramSegments = append(res.paramSegments, &paramSegment)
+	}
+
+	return &res
+}
+
+// getPattern returns the path of the route of this node, for example "/user/*".
+func (m *urlResolverPathPart) getPattern(isCatchAll bool) string {
+	if isCatchAll {
+		return m.pathPrefix + "/*"
+	}
+
+	if m.pathPrefix == "" {
+		return "/"
+	}
+
+	return m.pathPrefix
 }
@@ -0,0 +1,230 @@
+/*
+ * (C) Copyright 2024 Johan Michel PIQUET, France (https://johanpiquet.fr/).
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpServer
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// UrlResolverParam is a value captured by a named parameter of a route.
+type UrlResolverParam struct {
+	Name  string
+	Value string
+}
+
+// urlResolverParamSegment is a segment containing named parameters, like ":id" or "{name:[a-z]+}.{ext}".
+type urlResolverParamSegment struct {
+	// pattern is the segment as written in the route.
+	pattern string
+
+	names []string
+
+	// matcher is nil when the segment is only one parameter without constraint,
+	// in which case all the segment is captured.
+	matcher *regexp.Regexp
+
+	next *urlResolverPathPart
+}
+
+// gParamConstraints are the named constraints which can be used with "{name:constraint}".
+// Other constraints are regular expressions.
+var gParamConstraints = map[string]string{
+	"int":  `-?[0-9]+`,
+	"uuid": `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+}
+
+// isParamSegment returns true if the segment of a route contains named parameters.
+func isParamSegment(segment string) bool {
+	return strings.HasPrefix(segment, ":") || strings.Contains(segment, "{")
+}
+
+// newUrlResolverParamSegment parses a segment like ":id", "{id:int}" or "{name:[a-z]+}.{ext}".
+// It panics if the segment is invalid, like when adding a route with an invalid regular expression.
+func newUrlResolverParamSegment(pattern string) *urlResolverParamSegment {
+	res := &urlResolverParamSegment{pattern: pattern}
+
+	if pattern[0] == ':' {
+		res.names = []string{pattern[1:]}
+		return res
+	}
+
+	regex := "^"
+	hasConstraint := false
+
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '{' {
+			regex += regexp.QuoteMeta(pattern[i : i+1])
+			continue
+		}
+
+		end := findClosingBrace(pattern, i)
+		if end == -1 {
+			panic("invalid route segment, missing '}': " + pattern)
+		}
+
+		name, constraint, _ := strings.Cut(pattern[i+1:end], ":")
+
+		if constraint == "" {
+			constraint = `.+?`
+		} else {
+			hasConstraint = true
+
+			if named, isNamed := gParamConstraints[constraint]; isNamed {
+				constraint = named
+			}
+		}
+
+		regex += "(?P<p" + strconv.Itoa(len(res.names)) + ">" + constraint + ")"
+		res.names = append(res.names, name)
+
+		i = end
+	}
+
+	// A segment which is only "{name}" is the same as ":name".
+	if hasConstraint || (pattern != "{"+res.names[0]+"}") {
+		res.matcher = regexp.MustCompile(regex + "$")
+	}
+
+	return res
+}
+
+// findClosingBrace returns the position of the "}" closing the "{" at this position, or -1.
+// It allows a constraint like "[0-9]{2}".
+func findClosingBrace(pattern string, start int) int {
+	depth := 0
+
+	for i := start; i < len(pattern); i++ {
+		if pattern[i] == '{' {
+			depth++
+		} else if pattern[i] == '}' {
+			depth--
+
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+// gUrlParamSegments caches the segments parsed by buildUrlPath, avoiding compiling their regular expression each time.
+var gUrlParamSegments sync.Map
+
+// getUrlParamSegment returns the parsed segment, from the cache if possible.
+func getUrlParamSegment(segment string) *urlResolverParamSegment {
+	if cached, found := gUrlParamSegments.Load(segment); found {
+		return cached.(*urlResolverParamSegment)
+	}
+
+	res := newUrlResolverParamSegment(segment)
+	gUrlParamSegments.Store(segment, res)
+	return res
+}
+
+// buildUrlPath returns the path of a route pattern, where the named parameters are replaced by the escaped values.
+// All the parameters must be given, and all the values must be used.
+func buildUrlPath(pattern string, params map[string]string) (string, error) {
+	used := make(map[string]bool)
+	var res []string
+
+	for _, segment := range strings.Split(pattern, "/") {
+		if !isParamSegment(segment) {
+			if strings.HasSuffix(segment, "*") {
+				return "", fmt.Errorf("the route %q has wildcards without name", pattern)
+			}
+
+			res = append(res, segment)
+			continue
+		}
+
+		paramSegment := getUrlParamSegment(segment)
+		built := ""
+
+		if segment[0] == ':' {
+			value, found := params[segment[1:]]
+			if !found {
+				return "", fmt.Errorf("missing param %q for the route %q", segment[1:], pattern)
+			}
+
+			built = value
+			used[segment[1:]] = true
+		} else {
+			for i := 0; i < len(segment); i++ {
+				if segment[i] != '{' {
+					built += segment[i : i+1]
+					continue
+				}
+
+				end := findClosingBrace(segment, i)
+				name, _, _ := strings.Cut(segment[i+1:end], ":")
+
+				value, found := params[name]
+				if !found {
+					return "", fmt.Errorf("missing param %q for the route %q", name, pattern)
+				}
+
+				built += value
+				used[name] = true
+				i = end
+			}
+		}
+
+		if paramSegment.match(built) == nil {
+			return "", fmt.Errorf("the params don't match the segment %q of the route %q", segment, pattern)
+		}
+
+		res = append(res, url.PathEscape(built))
+	}
+
+	for name := range params {
+		if !used[name] {
+			return "", fmt.Errorf("unknown param %q for the route %q", name, pattern)
+		}
+	}
+
+	return strings.Join(res, "/"), nil
+}
+
+// match returns the values of the parameters, or nil if the segment doesn't match.
+func (m *urlResolverParamSegment) match(segment string) []string {
+	if segment == "" {
+		return nil
+	}
+
+	if m.matcher == nil {
+		return []string{segment}
+	}
+
+	found := m.matcher.FindStringSubmatch(segment)
+	if found == nil {
+		return nil
+	}
+
+	values := make([]string, len(m.names))
+
+	for i := range m.names {
+		values[i] = found[m.matcher.SubexpIndex("p"+strconv.Itoa(i))]
+	}
+
+	return values
+}
@@ -18,7 +18,9 @@ package httpServer
 
 import (
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -279,6 +281,247 @@ func TestMiddlewares(test *testing.T) {
 	doMiddlewaresAssertions()
 }
 
+func TestRemoving(test *testing.T) {
+	gTest = test
+	buildPathSet()
+	addMiddlewares()
+
+	if !gUrlResolver.Remove("/products/any/*") || !gUrlResolver.Remove("/vip/johan") ||
+		!gUrlResolver.Remove("/products/listing1b*/suite1B") {
+		test.Error("The existing paths must be removed")
+	}
+
+	if gUrlResolver.Remove("/vip/johan") || gUrlResolver.Remove("/unknown") || gUrlResolver.Remove("/clients/*") {
+		test.Error("Removing an unknown path must return false")
+	}
+
+	expectNotFound("/products/any/*", "/products/any/aa")
+	expectNotFound("/vip/johan", "/vip/johan")
+	expectNotFound("/products/listing1b*/suite1B", "/products/listing1bfff/suite1B")
+
+	expectFound("/vip", "/vip")
+	expectFound("/products/listing1b*", "/products/listing1bfff")
+	expectWildcards("/products/listing1*/suiteA", "/products/listing1MY_WILDCARD/suiteA", "MY_WILDCARD", "")
+
+	if gUrlResolver.load().root.segmentMap["vip"].segmentMap["johan"] != nil {
+		test.Error("The empty nodes must be removed")
+	}
+
+	if !gUrlResolver.RemoveMiddlewares("/clients/johan") || !gUrlResolver.RemoveMiddlewares("/wildcards/*") {
+		test.Error("The existing middlewares must be removed")
+	}
+
+	if gUrlResolver.RemoveMiddlewares("/clients/johan") || gUrlResolver.RemoveMiddlewares("/vip") {
+		test.Error("Removing unknown middlewares must return false")
+	}
+
+	expectMiddleware("/clients/johan", []string{})
+	expectMiddleware("/clients", []string{"/clients"})
+	expectMiddleware("/wildcards/w1*/suite/w2*", []string{"/wildcards/w1*/suite/w2*"})
+}
+
+func expectParams(testing string, samplePath string, expectedParams string) {
+	res := expectFound(testing, samplePath)
+	if res == nil {
+		return
+	}
+
+	var found []string
+
+	for _, param := range res.GetParams() {
+		found = append(found, param.Name+"="+param.Value)
+	}
+
+	if strings.Join(found, " ") != expectedParams {
+		gTest.Error("Invalid params for url [", samplePath, "]",
+			"\n- Found [", strings.Join(found, " "), "]",
+			"\n- Expected [", expectedParams, "]")
+	}
+}
+
+func TestNamedParams(test *testing.T) {
+	gTest = test
+	buildPathSet()
+
+	addPath("/users/:id")
+	addPath("/users/me")
+	addPath("/users/:id/posts/:slug")
+	addPath("/orders/{id:int}")
+	addPath("/orders/{ref}")
+	addPath("/tokens/{token:uuid}")
+	addPath("/files/{name:[a-z]+}.{ext}")
+	addPath("/codes/{code:[A-Z]{2}}")
+	addPath("/products/:category/*")
+
+	expectFound("/users/me", "/users/me")
+	expectParams("/users/:id", "/users/john", "id=john")
+	expectParams("/users/:id/posts/:slug", "/users/john/posts/hello-world", "id=john slug=hello-world")
+	expectNotFound("/users/:id", "/users/")
+
+	expectParams("/orders/{id:int}", "/orders/125", "id=125")
+	expectParams("/orders/{ref}", "/orders/abc", "ref=abc")
+
+	expectParams("/tokens/{token:uuid}", "/tokens/0f8fad5b-d9cb-469f-a165-70867728950e", "token=0f8fad5b-d9cb-469f-a165-70867728950e")
+	expectNotFound("/tokens/{token:uuid}", "/tokens/not-an-uuid")
+
+	expectParams("/files/{name:[a-z]+}.{ext}", "/files/report.tar.gz", "name=report ext=tar.gz")
+	expectNotFound("/files/{name:[a-z]+}.{ext}", "/files/Report.pdf")
+
+	expectParams("/codes/{code:[A-Z]{2}}", "/codes/FR", "code=FR")
+	expectNotFound("/codes/{code:[A-Z]{2}}", "/codes/FRA")
+
+	// The existing rules are still matched first.
+	expectFound("/products/any/*", "/products/any/aa")
+	expectFound("/products/listing1*", "/products/listing1fff")
+	expectParams("/products/:category/*", "/products/bedroom/bed", "category=bedroom")
+
+	res := gUrlResolver.Find("/users/john/posts/hello")
+	if (res.GetParam("slug") != "hello") || (res.GetParam("unknown") != "") || (res.GetPattern() != "/users/:id/posts/:slug") {
+		test.Error("Invalid params [", res.GetParams(), "] pattern [", res.GetPattern(), "]")
+	}
+
+	if !gUrlResolver.Remove("/users/:id/posts/:slug") {
+		test.Error("The route with params must be removed")
+	}
+
+	expectNotFound("/users/:id/posts/:slug", "/users/john/posts/hello")
+	expectParams("/users/:id", "/users/john", "id=john")
+}
+
+func TestFindOptions(test *testing.T) {
+	resolver := NewUrlResolver()
+	resolver.Add("/Docs/:page", "page", nil)
+	resolver.Add("/files/*", "files", nil)
+	resolver.Add("/img/photo*", "photo", nil)
+
+	caseInsensitive := &UrlResolverFindOptions{CaseInsensitive: true}
+	emptyCatchAll := &UrlResolverFindOptions{MatchEmptyCatchAll: true}
+
+	if resolver.Find("/docs/Intro").Target != nil {
+		test.Error("The default matching must take care of the case")
+	}
+
+	res := resolver.FindWithOptions("/DOCS/Intro", caseInsensitive)
+	if (res.Target != "page") || (res.GetParam("page") != "Intro") {
+		test.Error("Invalid case insensitive match [", res.Target, res.GetParams(), "]")
+	}
+
+	res = resolver.FindWithOptions("/IMG/PHOTO-1.png", caseInsensitive)
+	if (res.Target != "photo") || (res.GetWildcards()[0] != "-1.png") {
+		test.Error("Invalid case insensitive prefix match [", res.Target, "]")
+	}
+
+	if resolver.Find("/files/").Target != nil {
+		test.Error("The catch-all must not match an empty segment by default")
+	}
+
+	if resolver.FindWithOptions("/files/", emptyCatchAll).Target != "files" {
+		test.Error("The catch-all must match an empty segment with MatchEmptyCatchAll")
+	}
+}
+
+func TestConcurrentAddAndFind(test *testing.T) {
+	resolver := NewUrlResolver()
+	resolver.Add("/static/*", "static", nil)
+	resolver.AppendMiddleware("/api/*", "api", nil)
+
+	const writerCount = 4
+	const routeCount = 50
+
+	var waitWriters sync.WaitGroup
+	var waitReaders sync.WaitGroup
+	done := make(chan struct{})
+
+	for w := 0; w < writerCount; w++ {
+		waitWriters.Add(1)
+
+		go func(w int) {
+			defer waitWriters.Done()
+			prefix := "/api/w" + strconv.Itoa(w)
+
+			for i := 0; i < routeCount; i++ {
+				id := strconv.Itoa(i)
+
+				resolver.Add(prefix+"/items/"+id, id, nil)
+				resolver.Add(prefix+"/files-"+id+"-*", id, nil)
+				resolver.AddNamed(prefix+"-user-"+id, prefix+"/users/:id/"+id, id, nil)
+				resolver.AppendMiddleware(prefix+"/items/"+id, "item", nil)
+
+				if i%10 == 0 {
+					resolver.Remove(prefix + "/files-" + id + "-*")
+				}
+			}
+		}(w)
+	}
+
+	for r := 0; r < 4; r++ {
+		waitReaders.Add(1)
+
+		go func() {
+			defer waitReaders.Done()
+
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				if resolver.Find("/static/app.js").Target != "static" {
+					test.Error("The existing route must always be found")
+					return
+				}
+
+				res := resolver.Find("/api/w1/items/5")
+				if (res.Target != nil) && ((res.Target != "5") || (len(res.Middlewares) == 0)) {
+					test.Error("Invalid route [", res.Target, "] middlewares [", res.Middlewares, "]")
+					return
+				}
+
+				resolver.Find("/api/w2/files-12-ab")
+				resolver.Find("/api/w3/users/john/7")
+				resolver.GetNamedPattern("/api/w0-user-3")
+				resolver.DumpTree()
+			}
+		}()
+	}
+
+	waitWriters.Wait()
+	close(done)
+	waitReaders.Wait()
+
+	for w := 0; w < writerCount; w++ {
+		prefix := "/api/w" + strconv.Itoa(w)
+
+		for i := 0; i < routeCount; i++ {
+			id := strconv.Itoa(i)
+
+			res := resolver.Find(prefix + "/items/" + id)
+			if (res.Target != id) || (len(res.Middlewares) != 2) {
+				test.Error("Route not found or invalid middlewares for [", prefix, id, "]")
+			}
+
+			res = resolver.Find(prefix + "/users/john/" + id)
+			if (res.Target != id) || (res.GetParam("id") != "john") {
+				test.Error("Named route not found for [", prefix, id, "]")
+			}
+
+			expectedFile := id
+			if i%10 == 0 {
+				expectedFile = ""
+			}
+
+			if target, _ := resolver.Find(prefix + "/files-" + id + "-x").Target.(string); target != expectedFile {
+				test.Error("Invalid prefix route for [", prefix, id, "] found [", target, "]")
+			}
+
+			if pattern, _ := resolver.GetNamedPattern(prefix + "-user-" + id); pattern != prefix+"/users/:id/"+id {
+				test.Error("Invalid named pattern for [", prefix, id, "] found [", pattern, "]")
+			}
+		}
+	}
+}
+
 func TestBenchmark(test *testing.T) {
 	// Score before refactoring:
 	//		5000000  tests executed in  1109 ms.